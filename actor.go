@@ -2,18 +2,46 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
 )
 
+// TDynParamType : type of actor runtime parameter ('DynParamType', RefValues DynParamT)
+type TDynParamType int
+
+const (
+	DynParamNone TDynParamType = iota
+	DynParamBool
+	DynParamInt
+	DynParamFloat
+	DynParamText
+	DynParamDateTime
+	DynParamURL
+	DynParamEmail
+	DynParamTel
+)
+
+// dynParamRegexp : RefValues regexp checking runtime parameters of these types
+var dynParamRegexp = map[TDynParamType]string{
+	DynParamURL:   "url",
+	DynParamEmail: "email",
+	DynParamTel:   "tel",
+}
+
+// dynParamDateTimeLayouts : accepted DateTime runtime parameters, normalised with the first one
+var dynParamDateTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05Z07:00", "2006-01-02"}
+
 func init() {
 	RegisterInternalFunc(ActorFunc, "GoHomeExit", GoHomeExit)
 	RegisterInternalFunc(ActorFunc, "SendSMS", SendSMS)
@@ -21,24 +49,22 @@ func init() {
 }
 
 // triggerActorById : trigger actor function using ActCmd, restirered parameter 'ActParam' and dynamic param 'param'
+// The actor job is waited for (see actorjob.go)
 func triggerActorById(actorId int, userId int, param string) (result string, err error) {
-
-	objs, err := getHomeObjects(nil, ItemIdNone, actorId)
+	job, err := startActorJobById(actorId, userId, param)
 	if err != nil {
 		return
 	}
-	if len(objs) <= 0 {
-		err = errors.New(fmt.Sprintf("No actor with id = %d", actorId))
-		glog.Error(err)
-	}
-	actor := objs[0]
-
-	result, err = triggerObjActor(actor, userId, param)
-	return
+	return job.getResult()
 }
 
 // triggerObjActor : trigger actor function using ActCmd, registered parameter 'ActParam' and dynamic param 'param'
-func triggerObjActor(actor HomeObject, userId int, param string) (result string, err error) {
+// Actor call is cancelled when ctx is done, a scene runs its steps (see scene.go)
+func triggerObjActor(ctx context.Context, actor HomeObject, userId int, param string) (result string, err error) {
+	if isScene(actor) {
+		return runScene(ctx, actor, userId, param)
+	}
+
 	result = "Failed"
 	actName, err := actor.getStrVal("Name")
 	if err != nil {
@@ -58,9 +84,9 @@ func triggerObjActor(actor HomeObject, userId int, param string) (result string,
 	}
 
 	if isInternal != 0 {
-		result, err = CallInternalFunc(ActorFunc, actCmd, actParam, param)
+		result, err = CallObjFunc(ctx, ActorFunc, actCmd, actor, actParam, param)
 	} else {
-		result, err = ExecExternalCmd(actCmd, actParam, param)
+		result, err = ExecExternalCmdContext(ctx, actCmd, actParam, param)
 	}
 
 	glog.Infof("Actor : user#%d : %s(%s) => %s", userId, actName, param, result)
@@ -68,28 +94,119 @@ func triggerObjActor(actor HomeObject, userId int, param string) (result string,
 		glog.Infof("Actor : %s('%s','%s')", actCmd, actParam, param)
 	}
 
-	go recordActorResult(actor, userId, param, result)
-
 	return
 }
 
-// recordActorResult : store in DB param and result for an actor
-func recordActorResult(actor HomeObject, userId int, param string, result string) {
+// checkActorParam : check runtime parameter against actor 'DynParamType' and return it normalised
+// Only user calls (TriggerActor, /simple page) are checked, a parameter given by a user to an actor without
+// runtime parameter (None) is ignored. SensorAct, Schedule and scene step parameters are passed as is.
+func checkActorParam(actor HomeObject, param string) (string, error) {
+	paramType := TDynParamType(actor.getOptIntVal("DynParamType", int(DynParamNone)))
+	value := strings.TrimSpace(param)
+
+	switch paramType {
+	case DynParamNone:
+		if len(value) > 0 && glog.V(1) {
+			glog.Infof("Actor %d : runtime parameter '%s' ignored", actor.getId(), param)
+		}
+		return "", nil
+	case DynParamText:
+		return param, nil
+	}
+
+	if len(value) <= 0 {
+		return "", errors.New(fmt.Sprintf("Actor %d : runtime parameter required", actor.getId()))
+	}
+	switch paramType {
+	case DynParamBool:
+		switch strings.ToLower(value) {
+		case "1", "true", "yes", "on":
+			return "1", nil
+		case "0", "false", "no", "off":
+			return "0", nil
+		}
+	case DynParamInt:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+	case DynParamFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+	case DynParamDateTime:
+		for _, layout := range dynParamDateTimeLayouts {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return t.In(time.Local).Format(dynParamDateTimeLayouts[0]), nil
+			}
+		}
+	case DynParamURL, DynParamEmail, DynParamTel:
+		refList, err := getRefList(nil, dynParamRegexp[paramType])
+		if err != nil || len(refList) <= 0 {
+			return "", errors.New(fmt.Sprintf("Actor %d : no '%s' regexp to check runtime parameter", actor.getId(), dynParamRegexp[paramType]))
+		}
+		re, err := regexp.Compile(refList[0].Label)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Actor %d : bad '%s' regexp : %s", actor.getId(), dynParamRegexp[paramType], err))
+		}
+		if re.MatchString(value) {
+			return value, nil
+		}
+	default:
+		return "", errors.New(fmt.Sprintf("Actor %d : unknown runtime parameter type %d", actor.getId(), paramType))
+	}
+
+	return "", errors.New(fmt.Sprintf("Actor %d : invalid runtime parameter '%s' (%s expected)", actor.getId(), param, paramType))
+}
+
+// String : DynParamT label
+func (paramType TDynParamType) String() string {
+	switch paramType {
+	case DynParamNone:
+		return "None"
+	case DynParamBool:
+		return "Bool"
+	case DynParamInt:
+		return "Int"
+	case DynParamFloat:
+		return "Float"
+	case DynParamText:
+		return "Text"
+	case DynParamDateTime:
+		return "DateTime"
+	case DynParamURL:
+		return "URL"
+	case DynParamEmail:
+		return "Email"
+	case DynParamTel:
+		return "Tel"
+	}
+	return fmt.Sprintf("DynParamT(%d)", int(paramType))
+}
+
+// recordActorResult : store in DB param, result and status of a finished actor job started at start
+// For a confirmed actor call (confirmTs not zero), its confirmation record (request at confirmTs) is updated
+// with the job start and end
+func recordActorResult(state ActorJobState, start time.Time, end time.Time, confirmTs time.Time) {
 	db, err := openDB()
 	if err != nil {
 		return
 	}
 	defer db.Close()
 
-	actorId := actor.getId()
-
-	_, err = db.Exec("insert into HistoActor values ( ?, ?, ?, ?, ?);", time.Now().Unix(), actorId, userId, param, result)
+	duration := int64(end.Sub(start) / time.Millisecond)
+	if !confirmTs.IsZero() {
+		_, err = db.Exec("update HistoActor set ts = ?, Res = ?, endTs = ?, duration = ?, status = ? where ts = ? and idObject = ? and idUser = ? and status = ?;",
+			start.Unix(), state.Result, end.Unix(), duration, string(state.Status), confirmTs.Unix(), state.IdObject, state.IdUser, string(ActorConfirmed))
+	} else {
+		_, err = db.Exec("insert into HistoActor (ts, idObject, idUser, Param, Res, endTs, duration, status) values ( ?, ?, ?, ?, ?, ?, ?, ?);",
+			start.Unix(), state.IdObject, state.IdUser, state.Param, state.Result, end.Unix(), duration, string(state.Status))
+	}
 	if err != nil {
-		glog.Errorf("Fail to store result (%s) for actor %d : %s ", result, actorId, err)
+		glog.Errorf("Fail to store result (%s) for actor %d : %s ", state.Result, state.IdObject, err)
 	}
 
 	if glog.V(2) {
-		glog.Infof("recordActorResult : %d - %s - %s", time.Now().Unix(), param, result)
+		glog.Infof("recordActorResult : %d - %s - %s (%s)", start.Unix(), state.Param, state.Result, state.Status)
 	}
 }
 
@@ -0,0 +1,158 @@
+// actorconfirm.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Actor confirmation
+//
+// An actor with 'Confirm' set is not called by the first user request (TriggerActor, /simple page) : the request
+// gets a confirmation token valid for actorConfirmDelay, the actor is called only when the same user confirms
+// with this token (ConfirmActor). The request is recorded in HistoActor with status confirm, then updated with
+// the outcome : rejected (declined), expired or confirmed, updated again with the actor job start, end, result
+// and status when the job ends. A token sent by another user or for another actor is refused, the request
+// stays pending.
+// SensorAct and GSM triggers are not interactive and never ask for confirmation.
+// -----------------------------------------------
+
+// HistoActor status of confirmation requests
+const (
+	ActorConfirmPending  TActorJobStatus = "confirm"
+	ActorConfirmed       TActorJobStatus = "confirmed"
+	ActorConfirmRejected TActorJobStatus = "rejected"
+	ActorConfirmExpired  TActorJobStatus = "expired"
+)
+
+// actorConfirmDelay : delay to confirm an actor call
+const actorConfirmDelay = 30 * time.Second
+
+// ActorConfirm : confirmation asked for an actor call
+type ActorConfirm struct {
+	Token    string
+	IdObject int
+	Expires  int64 // unix time
+}
+
+// actorConfirmReq : actor call waiting for confirmation
+type actorConfirmReq struct {
+	ActorConfirm
+	userId int
+	param  string
+	ts     time.Time
+	timer  *time.Timer
+}
+
+var actorConfirmsLock sync.Mutex
+var actorConfirms = map[string]*actorConfirmReq{}
+
+// -----------------------------------------------
+
+// isActorConfirmRequired : check if actor calls must be confirmed
+func isActorConfirmRequired(actor HomeObject) bool {
+	return actor.getOptIntVal("Confirm", 0) != 0
+}
+
+// requestActorConfirm : register an actor call waiting for confirmation and return its token
+func requestActorConfirm(actor HomeObject, userId int, param string) (confirm ActorConfirm, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		glog.Errorf("requestActorConfirm : %s", err)
+		return
+	}
+
+	now := time.Now()
+	req := &actorConfirmReq{ActorConfirm{hex.EncodeToString(b), actor.getId(), now.Add(actorConfirmDelay).Unix()}, userId, param, now, nil}
+
+	actorConfirmsLock.Lock()
+	actorConfirms[req.Token] = req
+	req.timer = time.AfterFunc(actorConfirmDelay, func() { expireActorConfirm(req.Token) })
+	actorConfirmsLock.Unlock()
+
+	recordActorConfirm(req, ActorConfirmPending, now)
+	glog.Infof("Actor : user#%d : confirmation asked for actor %d(%s)", userId, req.IdObject, param)
+
+	return req.ActorConfirm, nil
+}
+
+// confirmActor : user confirms (or rejects) an actor call, start the actor job if confirmed
+// A token used by another user or for another actor is refused and left pending for the requester
+func confirmActor(token string, actorId int, userId int, reject bool) (job *actorJob, err error) {
+	actorConfirmsLock.Lock()
+	req, found := actorConfirms[token]
+	switch {
+	case !found:
+		err = errors.New(fmt.Sprintf("Unknown or expired confirmation for actor %d", actorId))
+	case req.IdObject != actorId:
+		err = errors.New(fmt.Sprintf("Confirmation for actor %d used for actor %d", req.IdObject, actorId))
+	case req.userId != userId:
+		err = errors.New(fmt.Sprintf("Confirmation for actor %d asked by user %d used by user %d", req.IdObject, req.userId, userId))
+	default:
+		delete(actorConfirms, token)
+		req.timer.Stop()
+	}
+	actorConfirmsLock.Unlock()
+
+	if err != nil {
+		glog.Errorf("confirmActor : %s", err)
+		return
+	}
+
+	if reject {
+		err = errors.New(fmt.Sprintf("Actor %d rejected by user", req.IdObject))
+		glog.Errorf("confirmActor : %s", err)
+		recordActorConfirm(req, ActorConfirmRejected, time.Now())
+		return
+	}
+
+	actor, err := getActorById(req.IdObject)
+	if err != nil {
+		recordActorConfirm(req, ActorConfirmRejected, time.Now())
+		return
+	}
+	recordActorConfirm(req, ActorConfirmed, time.Now())
+	return launchActorJob(actor, req.userId, req.param, req.ts), nil
+}
+
+// expireActorConfirm : confirmation delay is over
+func expireActorConfirm(token string) {
+	actorConfirmsLock.Lock()
+	req, found := actorConfirms[token]
+	delete(actorConfirms, token)
+	actorConfirmsLock.Unlock()
+
+	if found {
+		if glog.V(1) {
+			glog.Infof("Actor : user#%d : confirmation expired for actor %d", req.userId, req.IdObject)
+		}
+		recordActorConfirm(req, ActorConfirmExpired, time.Now())
+	}
+}
+
+// recordActorConfirm : store a confirmation request (status confirm), then update it with its outcome
+func recordActorConfirm(req *actorConfirmReq, status TActorJobStatus, now time.Time) {
+	db, err := openDB()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	if status == ActorConfirmPending {
+		_, err = db.Exec("insert into HistoActor (ts, idObject, idUser, Param, Res, status) values ( ?, ?, ?, ?, ?, ?);",
+			req.ts.Unix(), req.IdObject, req.userId, req.param, "Confirmation required", string(status))
+	} else {
+		_, err = db.Exec("update HistoActor set Res = ?, endTs = ?, duration = ?, status = ? where ts = ? and idObject = ? and idUser = ? and status = ?;",
+			fmt.Sprintf("Confirmation %s", status), now.Unix(), int64(now.Sub(req.ts)/time.Millisecond), string(status), req.ts.Unix(), req.IdObject, req.userId, string(ActorConfirmPending))
+	}
+	if err != nil {
+		glog.Errorf("Fail to store confirmation (%s) for actor %d : %s ", status, req.IdObject, err)
+	}
+}
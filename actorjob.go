@@ -0,0 +1,360 @@
+// actorjob.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Actor jobs
+//
+// Each actor call runs as a job in its own goroutine, identified by a job id. Callers (API, sensorAct, GSM)
+// wait for the job or only for a while (TriggerActor) and get the job state to poll it later (GetActorJob,
+// which can wait for the job end). A job is :
+// - cancelled (external command killed) after actor 'Timeout' (default driverCallTimeout) : status timeout
+// - cancelled on demand (CancelActorJob) : status cancelled
+// An internal function (IsInternal) can't be interrupted : a timeout or a cancel only stops waiting for it,
+// the function may still complete its action. Job error says so.
+// Final state is recorded in HistoActor (start, end, duration, status), finished jobs are kept in memory
+// for actorJobKeep.
+// -----------------------------------------------
+
+// TActorJobStatus : actor job status
+type TActorJobStatus string
+
+const (
+	ActorJobRunning   TActorJobStatus = "running"
+	ActorJobDone      TActorJobStatus = "done"
+	ActorJobFailed    TActorJobStatus = "failed"
+	ActorJobCancelled TActorJobStatus = "cancelled"
+	ActorJobTimeout   TActorJobStatus = "timeout"
+)
+
+// actorJobKeep : delay finished jobs can still be read
+const actorJobKeep = 10 * time.Minute
+
+// actorJobMaxWait : max wait for a job end asked by API
+const actorJobMaxWait = time.Minute
+
+// actorCleanupWait : max wait for cancelled jobs end on cleanup
+const actorCleanupWait = 5 * time.Second
+
+// ActorJobState : state of an actor job
+type ActorJobState struct {
+	JobId    int64
+	IdObject int
+	IdUser   int
+	Param    string
+	Status   TActorJobStatus
+	Result   string
+	Error    string
+	Startts  int64 // unix time
+	Endts    int64 // unix time, 0 while running
+	Duration int64 // in ms
+}
+
+// actorJob : an actor call
+type actorJob struct {
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lock      sync.Mutex
+	state     ActorJobState
+	err       error
+	confirmTs time.Time // time of the confirmation request, zero if actor call was not confirmed
+}
+
+var actorJobsLock sync.Mutex
+var actorJobs = map[int64]*actorJob{}
+var actorJobSeq int64
+
+// actorHistoColumns : HistoActor columns added with actor jobs (DB created before actor jobs)
+var actorHistoColumns = []struct{ name, def string }{
+	{"endTs", "datetime"},
+	{"duration", "integer"},
+	{"status", "text"},
+}
+
+// actorHistoIndex : HistoActor index, not unique as an actor can be called twice in a second (i.e. by a scene)
+var actorHistoIndex = []string{
+	"drop index if exists HistoActor_PK",
+	"create index if not exists HistoActor_IDX on HistoActor (ts, idObject, idUser)",
+}
+
+// -----------------------------------------------
+
+// actorSetup : add HistoActor job columns and update its index if needed
+func actorSetup(db *sql.DB) (err error) {
+	rows, err := db.Query("pragma table_info(HistoActor)")
+	if err != nil {
+		glog.Errorf("actorSetup : %s", err)
+		return
+	}
+	columns := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err = rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			glog.Errorf("actorSetup : %s", err)
+			return
+		}
+		columns[name] = true
+	}
+	rows.Close()
+
+	for _, col := range actorHistoColumns {
+		if columns[col.name] {
+			continue
+		}
+		stmt := fmt.Sprintf("alter table HistoActor add column %s %s", col.name, col.def)
+		if _, err = db.Exec(stmt); err != nil {
+			glog.Errorf("actorSetup : %s : %s", stmt, err)
+			return
+		}
+	}
+	for _, stmt := range actorHistoIndex {
+		if _, err = db.Exec(stmt); err != nil {
+			glog.Errorf("actorSetup : %s : %s", stmt, err)
+			return
+		}
+	}
+
+	if glog.V(1) {
+		glog.Info("actorSetup Done")
+	}
+	return nil
+}
+
+// actorCleanup : cancel running jobs
+func actorCleanup() {
+	actorJobsLock.Lock()
+	jobs := make([]*actorJob, 0, len(actorJobs))
+	for _, job := range actorJobs {
+		job.cancel()
+		jobs = append(jobs, job)
+	}
+	actorJobsLock.Unlock()
+
+	// Wait for cancelled jobs end, so drivers are not closed under a running job
+	deadline := time.Now().Add(actorCleanupWait)
+	for _, job := range jobs {
+		if !job.wait(deadline.Sub(time.Now())) {
+			glog.Errorf("actorCleanup : job #%d still running", job.getState().JobId)
+		}
+	}
+
+	if glog.V(1) {
+		glog.Info("actorCleanup Done")
+	}
+}
+
+// -----------------------------------------------
+
+// getActorById : read actor (or scene) actorId
+func getActorById(actorId int) (actor HomeObject, err error) {
+	objs, err := getHomeObjects(nil, ItemIdNone, actorId)
+	if err != nil {
+		return
+	}
+	if len(objs) <= 0 || (objs[0].Fields[0].IdItem != ItemActor && objs[0].Fields[0].IdItem != ItemScene) {
+		err = errors.New(fmt.Sprintf("No actor with id = %d", actorId))
+		glog.Error(err)
+		return
+	}
+	return objs[0], nil
+}
+
+// startActorJobById : start a job for actor actorId
+func startActorJobById(actorId int, userId int, param string) (job *actorJob, err error) {
+	actor, err := getActorById(actorId)
+	if err != nil {
+		return
+	}
+	return startActorJob(actor, userId, param), nil
+}
+
+// startActorJob : start a job calling actor with dynamic param 'param'
+func startActorJob(actor HomeObject, userId int, param string) *actorJob {
+	return launchActorJob(actor, userId, param, time.Time{})
+}
+
+// launchActorJob : start a job calling actor, for a call confirmed if confirmTs is not zero
+func launchActorJob(actor HomeObject, userId int, param string, confirmTs time.Time) *actorJob {
+	timeout := getActorTimeout(actor)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	job := &actorJob{cancel: cancel, done: make(chan struct{}), confirmTs: confirmTs}
+	start := time.Now()
+
+	actorJobsLock.Lock()
+	purgeActorJobs(start)
+	actorJobSeq++
+	job.state = ActorJobState{JobId: actorJobSeq, IdObject: actor.getId(), IdUser: userId, Param: param, Status: ActorJobRunning, Startts: start.Unix()}
+	actorJobs[job.state.JobId] = job
+	actorJobsLock.Unlock()
+
+	if glog.V(2) {
+		glog.Infof("Actor job #%d : actor %d started (timeout %v)", job.state.JobId, job.state.IdObject, timeout)
+	}
+
+	go job.run(ctx, actor, start, timeout)
+	return job
+}
+
+// run : call actor then record result
+func (job *actorJob) run(ctx context.Context, actor HomeObject, start time.Time, timeout time.Duration) {
+	defer job.cancel()
+
+	result, err := triggerObjActor(ctx, actor, job.state.IdUser, job.state.Param)
+	end := time.Now()
+
+	status := ActorJobDone
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		status = ActorJobTimeout
+		err = errors.New(fmt.Sprintf("actor %d : timeout after %v%s", actor.getId(), timeout, actorNotInterrupted(actor)))
+	case ctx.Err() == context.Canceled:
+		status = ActorJobCancelled
+		err = errors.New(fmt.Sprintf("actor %d : cancelled%s", actor.getId(), actorNotInterrupted(actor)))
+	case err != nil:
+		status = ActorJobFailed
+	}
+
+	job.lock.Lock()
+	job.state.Status = status
+	job.state.Result = result
+	job.state.Endts = end.Unix()
+	job.state.Duration = int64(end.Sub(start) / time.Millisecond)
+	job.err = err
+	if err != nil {
+		job.state.Error = err.Error()
+	}
+	state := job.state
+	job.lock.Unlock()
+	close(job.done)
+
+	if err != nil {
+		glog.Errorf("Actor job #%d : %s", state.JobId, err)
+	}
+	recordActorResult(state, start, end, job.confirmTs)
+}
+
+// actorNotInterrupted : error note for a timeout or cancelled job of an internal function actor
+func actorNotInterrupted(actor HomeObject) string {
+	if isScene(actor) || actor.getOptIntVal("IsInternal", 0) == 0 {
+		return ""
+	}
+	return " (internal function not interrupted, it may still complete)"
+}
+
+// Cancel : cancel the job, no effect if job is finished
+func (job *actorJob) Cancel() {
+	job.cancel()
+}
+
+// wait : wait at most timeout for job end, false if job is still running
+func (job *actorJob) wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case <-job.done:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case <-job.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// getState : copy of job state
+func (job *actorJob) getState() ActorJobState {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.state
+}
+
+// getResult : wait for job end and return actor result
+func (job *actorJob) getResult() (string, error) {
+	<-job.done
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.state.Result, job.err
+}
+
+// -----------------------------------------------
+
+// getActorJob : running or recently finished job
+func getActorJob(jobId int64) (job *actorJob, err error) {
+	actorJobsLock.Lock()
+	job, found := actorJobs[jobId]
+	actorJobsLock.Unlock()
+	if !found {
+		err = errors.New(fmt.Sprintf("No actor job with id = %d", jobId))
+	}
+	return
+}
+
+// getActorJobs : state of running and recently finished jobs, sorted by job id
+func getActorJobs() (states []ActorJobState) {
+	actorJobsLock.Lock()
+	for _, job := range actorJobs {
+		states = append(states, job.getState())
+	}
+	actorJobsLock.Unlock()
+
+	sort.Slice(states, func(i, j int) bool { return states[i].JobId < states[j].JobId })
+	return
+}
+
+// purgeActorJobs : forget jobs finished for more than actorJobKeep, actorJobsLock must be held
+func purgeActorJobs(now time.Time) {
+	for jobId, job := range actorJobs {
+		state := job.getState()
+		if state.Status != ActorJobRunning && now.Sub(time.Unix(state.Endts, 0)) > actorJobKeep {
+			delete(actorJobs, jobId)
+		}
+	}
+}
+
+// -----------------------------------------------
+
+// getActorTimeout : actor 'Timeout' or driverCallTimeout (sceneTimeout for a scene) if not set (or invalid)
+func getActorTimeout(actor HomeObject) time.Duration {
+	defTimeout := driverCallTimeout
+	if isScene(actor) {
+		defTimeout = sceneTimeout
+	}
+	timeoutStr := strings.TrimSpace(actor.getOptStrVal("Timeout", ""))
+	if len(timeoutStr) <= 0 {
+		return defTimeout
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout <= 0 {
+		glog.Errorf("Bad timeout (%s) for actor %d, using %v", timeoutStr, actor.getId(), defTimeout)
+		return defTimeout
+	}
+	return timeout
+}
+
+// checkActorTimeout : check actor timeout (if any) is a valid duration
+func checkActorTimeout(actor HomeObject) (err error) {
+	timeoutStr := strings.TrimSpace(actor.getOptStrVal("Timeout", ""))
+	if len(timeoutStr) <= 0 {
+		return
+	}
+	_, err = time.ParseDuration(timeoutStr)
+	return
+}
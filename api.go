@@ -2,8 +2,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -11,35 +14,89 @@ import (
 
 // -----------------------------------------------
 
-// Accepted Format = {"command":"api...", "itemid":id, "objectid":id, "startts":ts, "endts":ts, "jsonparam":{...}}
+// Accepted Format = {"command":"api...", "itemid":id, "objectid":id, "startts":ts, "endts":ts, "resolution":sec, "jsonparam":{...}}
 
 type apiCommand string
 
 const (
-	apiReadRefList      apiCommand = "ReadRefList"
-	apiReadCurrentUser             = "ReadCurrentUser"
-	apiReadItem                    = "ReadItem"
-	apiReadObject                  = "ReadObject"
-	apiReadSensor                  = "ReadSensor"
-	apiGetSensorLastVal            = "GetSensorLastVal"
-	apiReadHistoVal                = "ReadHistoVal"
-	apiReadActorRes                = "ReadActorRes"
-	apiSaveItem                    = "SaveItems"
-	apiSaveObject                  = "SaveObject"
-	apiDeleteItem                  = "DeleteItems"
-	apiDeleteObject                = "DeleteObject"
-	apiSendSensorVal               = "SendSensorVal"
-	apiTriggerActor                = "TriggerActor"
+	apiReadRefList       apiCommand = "ReadRefList"
+	apiReadCurrentUser              = "ReadCurrentUser"
+	apiReadItem                     = "ReadItem"
+	apiReadObject                   = "ReadObject"
+	apiReadSensor                   = "ReadSensor"
+	apiGetSensorLastVal             = "GetSensorLastVal"
+	apiReadHistoVal                 = "ReadHistoVal"
+	apiReadActorRes                 = "ReadActorRes"
+	apiSaveItem                     = "SaveItems"
+	apiSaveObject                   = "SaveObject"
+	apiDeleteItem                   = "DeleteItems"
+	apiDeleteObject                 = "DeleteObject"
+	apiSendSensorVal                = "SendSensorVal"
+	apiTriggerActor                 = "TriggerActor"
+	apiGetSensorActState            = "GetSensorActState"
+	apiGetSensorSchedule            = "GetSensorSchedule"
+	apiReplaySensorAct              = "ReplaySensorAct"
+	apiEvalSensorAct                = "EvalSensorAct"
+	apiGetActorJob                  = "GetActorJob"
+	apiCancelActorJob               = "CancelActorJob"
+	apiConfirmActor                 = "ConfirmActor"
+	apiGetSchedule                  = "GetSchedule"
 )
 
+// apiSensorVal : one sensor reading sent with apiSendSensorVal
+// Ts is a unix timestamp (0 for server time), IdObject may be omitted to use command Objectid
+type apiSensorVal struct {
+	IdObject int
+	Ts       int64
+	Val      interface{}
+}
+
+// apiSensorValResp : ReadSensor / GetSensorLastVal response, sensor value and sensor health
+type apiSensorValResp struct {
+	HistoSensor
+	Health SensorHealth
+}
+
+// apiEvalSensorActParam : EvalSensorAct jsonparam, Object is a sensorAct as sent to SaveObject (saved sensorAct Objectid if omitted)
+type apiEvalSensorActParam struct {
+	Object  *HomeObject
+	PrevVal string
+	LastVal string
+}
+
+// apiActorJobParam : GetActorJob / CancelActorJob jsonparam
+// GetActorJob : wait at most Wait seconds for job end, all jobs (of actor Objectid if set) if JobId is 0
+type apiActorJobParam struct {
+	JobId int64
+	Wait  int
+}
+
+// apiConfirmActorParam : ConfirmActor jsonparam, token returned by TriggerActor, Reject to decline the actor call
+type apiConfirmActorParam struct {
+	Token  string
+	Reject bool
+}
+
+// apiScheduleParam : GetSchedule jsonparam (optional), Count upcoming runs listed for each schedule (default 1)
+type apiScheduleParam struct {
+	Count int
+}
+
+// Max accepted delay between server time and a reading timestamp in the future
+const apiSensorValMaxSkew = time.Minute
+
+// Delay TriggerActor waits for actor result before returning the running job
+const apiTriggerActorWait = 2 * time.Second
+
 type apiCommandSruct struct {
-	Command   apiCommand
-	Itemid    TItemId
-	Objectid  int
-	Startts   int64
-	Endts     int64
-	Jsonparam string
-	UserCode  string
+	Command    apiCommand
+	Itemid     TItemId
+	Objectid   int
+	Startts    int64
+	Endts      int64
+	Resolution int64 // ReadHistoVal : wanted seconds between values (0 for raw values)
+	Jsonparam  string
+	UserCode   string
 }
 
 // -----------------------------------------------
@@ -138,7 +195,9 @@ func fctApiGetSensorVal(profil TUserProfil, jsonCmde apiCommandSruct, read bool)
 
 	var value string
 	if read {
-		value, err = readSensorValue(sensor)
+		if value, err = readSensorWithWorker(context.Background(), sensor); err != nil {
+			sensorHealthFailed(sensor, err)
+		}
 	} else {
 		value, err = getSensorLastValue(sensor)
 	}
@@ -147,7 +206,108 @@ func fctApiGetSensorVal(profil TUserProfil, jsonCmde apiCommandSruct, read bool)
 		return
 	}
 
-	apiResp, err = json.Marshal(HistoSensor{time.Now(), jsonCmde.Objectid, value})
+	apiResp, err = json.Marshal(apiSensorValResp{HistoSensor{time.Now(), jsonCmde.Objectid, value}, getSensorHealth(jsonCmde.Objectid)})
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, err))
+		return
+	}
+	return
+}
+
+func fctApiGetSensorActState(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	err := checkAccessToObjectId(profil, jsonCmde.Objectid)
+	if err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	apiResp, err = json.Marshal(getSensorActState(jsonCmde.Objectid))
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, err))
+		return
+	}
+	return
+}
+
+// fctApiGetSensorSchedule : scheduling state of scheduled sensors (Objectid > 0 for a single sensor)
+func fctApiGetSensorSchedule(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	states := []SensorJobState{}
+	for _, state := range getSensorSchedule() {
+		if jsonCmde.Objectid > 0 && state.IdObject != jsonCmde.Objectid {
+			continue
+		}
+		sensorRegistryLock.Lock()
+		sensor, found := sensorRegistry[state.IdObject]
+		sensorRegistryLock.Unlock()
+		if !found || checkAccessToObject(profil, sensor) != nil {
+			continue
+		}
+		states = append(states, state)
+	}
+
+	apiResp, err := json.Marshal(states)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+		return
+	}
+	return
+}
+
+// fctApiGetSchedule : active schedules with their upcoming runs (Objectid > 0 for a single schedule)
+func fctApiGetSchedule(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	param := apiScheduleParam{Count: 1}
+	if len(strings.TrimSpace(jsonCmde.Jsonparam)) > 0 {
+		if err := json.Unmarshal([]byte(jsonCmde.Jsonparam), &param); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+			return
+		}
+	}
+
+	states := []ScheduleState{}
+	for _, state := range getSchedules(param.Count) {
+		if jsonCmde.Objectid > 0 && state.IdObject != jsonCmde.Objectid {
+			continue
+		}
+		schedule, found := getScheduleObject(state.IdObject)
+		if !found || checkAccessToObject(profil, schedule) != nil {
+			continue
+		}
+		states = append(states, state)
+	}
+
+	apiResp, err := json.Marshal(states)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+		return
+	}
+	return
+}
+
+// fctApiReplaySensorAct : replay recorded master sensor values between Startts and Endts through sensorAct Objectid
+// Endts = 0 for now, Startts = 0 for one month before Endts, at most replayApiMaxValues values
+func fctApiReplaySensorAct(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	err := checkAccessToObjectId(profil, jsonCmde.Objectid)
+	if err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	end := time.Now()
+	if jsonCmde.Endts > 0 {
+		end = time.Unix(jsonCmde.Endts, 0)
+	}
+	start := end.AddDate(0, -1, 0)
+	if jsonCmde.Startts > 0 {
+		start = time.Unix(jsonCmde.Startts, 0)
+	}
+
+	result, err := replaySensorAct(nil, jsonCmde.Objectid, start, end, replayApiMaxValues)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, err))
+		return
+	}
+
+	apiResp, err = json.Marshal(result)
 	if err != nil {
 		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, err))
 		return
@@ -155,6 +315,168 @@ func fctApiGetSensorVal(profil TUserProfil, jsonCmde apiCommandSruct, read bool)
 	return
 }
 
+// fctApiEvalSensorAct : dry-run of a sensorAct (saved or not) for hypothetical master sensor values
+func fctApiEvalSensorAct(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	var param apiEvalSensorActParam
+	if err := json.Unmarshal([]byte(jsonCmde.Jsonparam), &param); err != nil {
+		apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+		return
+	}
+
+	var sensorAct HomeObject
+	if param.Object != nil {
+		// Unsaved sensorAct : use fields definition from DB
+		fields, err := getItemFields(nil, ItemSensorAct, 0)
+		if err != nil {
+			apiResp = apiError(err.Error())
+			return
+		}
+		sensorAct = *param.Object
+		if len(sensorAct.Values) <= 0 {
+			apiResp = apiError(fmt.Sprintf("%s : sensorAct without values", jsonCmde.Command))
+			return
+		}
+		sensorAct.Fields = fields
+		sensorAct.Values = alignValues(fields, sensorAct.Values)
+		if err = sensorAct.ValidateValues(sensorAct.Values); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err))
+			return
+		}
+	} else {
+		objs, err := getHomeObjects(nil, ItemIdNone, jsonCmde.Objectid)
+		if err != nil {
+			apiResp = apiError(err.Error())
+			return
+		}
+		if len(objs) <= 0 || objs[0].Fields[0].IdItem != ItemSensorAct {
+			apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : sensorAct not found", jsonCmde.Command, jsonCmde.Objectid))
+			return
+		}
+		sensorAct = objs[0]
+	}
+	if err := checkAccessToObject(profil, sensorAct); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	masterId, err := sensorAct.getIntVal("idMasterObj")
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err))
+		return
+	}
+	sensors, err := getHomeObjects(nil, ItemIdNone, masterId)
+	if err != nil || len(sensors) <= 0 {
+		apiResp = apiError(fmt.Sprintf("%s : master sensor %d not found", jsonCmde.Command, masterId))
+		return
+	}
+	if err = checkAccessToObject(profil, sensors[0]); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	apiResp, err = json.Marshal(dryRunSensorAct(sensorAct, sensors[0], param.PrevVal, param.LastVal, time.Now()))
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+		return
+	}
+	return
+}
+
+// fctApiSendSensorVal : handle sensor readings pushed by clients
+// Jsonparam is a reading {"IdObject":id, "Ts":ts, "Val":value} or an array of readings
+// All readings are checked before any is handled : one bad reading reject the whole batch
+// Readings are handled in chronological order, a reading older than the sensor last value is only recorded
+func fctApiSendSensorVal(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	var readings []apiSensorVal
+	param := strings.TrimSpace(jsonCmde.Jsonparam)
+	if strings.HasPrefix(param, "[") {
+		if err := json.Unmarshal([]byte(param), &readings); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+			return
+		}
+	} else {
+		var reading apiSensorVal
+		if err := json.Unmarshal([]byte(param), &reading); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+			return
+		}
+		readings = append(readings, reading)
+	}
+	if len(readings) <= 0 {
+		apiResp = apiError(fmt.Sprintf("%s : no sensor value", jsonCmde.Command))
+		return
+	}
+
+	now := time.Now()
+	sensors := map[int]HomeObject{}
+	values := make([]HistoSensor, len(readings))
+	for i, reading := range readings {
+		if reading.IdObject <= 0 {
+			reading.IdObject = jsonCmde.Objectid
+		}
+
+		sensor, found := sensors[reading.IdObject]
+		if !found {
+			objs, err := getHomeObjects(nil, ItemIdNone, reading.IdObject)
+			if err != nil {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, reading.IdObject, err))
+				return
+			}
+			if len(objs) <= 0 || objs[0].Fields[0].IdItem != ItemSensor {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : sensor not found", jsonCmde.Command, reading.IdObject))
+				return
+			}
+			sensor = objs[0]
+			if err = checkAccessToObject(profil, sensor); err != nil {
+				apiResp = apiError(err.Error())
+				return
+			}
+			if isActive, err := sensor.getIntVal("IsActive"); err != nil || isActive == 0 {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : sensor not active", jsonCmde.Command, reading.IdObject))
+				return
+			}
+			sensors[reading.IdObject] = sensor
+		}
+
+		ts := now
+		if reading.Ts > 0 {
+			ts = time.Unix(reading.Ts, 0)
+			if ts.Sub(now) > apiSensorValMaxSkew {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : timestamp %d in the future", jsonCmde.Command, reading.IdObject, reading.Ts))
+				return
+			}
+		}
+
+		if reading.Val == nil {
+			apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : no value", jsonCmde.Command, reading.IdObject))
+			return
+		}
+		value, err := transformSensorValue(sensor, exprFormat(reading.Val))
+		if err != nil {
+			apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d) : %s", jsonCmde.Command, reading.IdObject, err))
+			return
+		}
+		if err = checkSensorValue(sensor, value); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+			return
+		}
+
+		values[i] = HistoSensor{ts, reading.IdObject, normaliseSensorValue(sensor, value)}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Ts.Before(values[j].Ts) })
+	for _, value := range values {
+		handleSensorValue(value.Ts, sensors[value.IdObject], value.Val)
+	}
+
+	apiResp, err := json.Marshal(values)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+		return
+	}
+	return
+}
+
 func fctApiReadHistoVal(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
 	last := false
 	if (jsonCmde.Startts <= 0 && jsonCmde.Endts <= 0) || jsonCmde.Startts > time.Now().Unix() {
@@ -167,12 +489,36 @@ func fctApiReadHistoVal(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp [
 		return
 	}
 
+	// Use rollups if a resolution is requested and available for the sensor
+	if res := histoRollupFor(jsonCmde.Resolution); !last && res > 0 {
+		objs, err := getHomeObjects(nil, ItemIdNone, jsonCmde.Objectid)
+		if err == nil && len(objs) > 0 && isRollupDataType(objs[0]) {
+			rVals, err := getSensorRollups(nil, jsonCmde.Objectid, res, time.Unix(jsonCmde.Startts, 0), time.Unix(jsonCmde.Endts, 0))
+			if err != nil {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d, start=%d, end=%d, res=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts, res, err))
+				return
+			}
+			if apiResp, err = json.Marshal(rVals); err != nil {
+				apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d, start=%d, end=%d, res=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts, res, err))
+			}
+			return
+		}
+	}
+
 	sVals, err := getHistoSensor(nil, jsonCmde.Objectid, last, time.Unix(jsonCmde.Startts, 0), time.Unix(jsonCmde.Endts, 0))
 	if err != nil {
 		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d, start=%d, end=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts, err))
 		return
 	}
 
+	// For json sensors, Jsonparam may give the path of a single field to return (i.e. "temp")
+	if path := strings.TrimSpace(jsonCmde.Jsonparam); len(path) > 0 {
+		if sVals, err = projectHistoSensor(sVals, path); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d, path=%s) : %s", jsonCmde.Command, jsonCmde.Objectid, path, err))
+			return
+		}
+	}
+
 	apiResp, err = json.Marshal(sVals)
 	if err != nil {
 		apiResp = apiError(fmt.Sprintf("%s failed for (obj=%d, start=%d, end=%d) : %s", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts, err))
@@ -182,6 +528,23 @@ func fctApiReadHistoVal(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp [
 	return
 }
 
+// projectHistoSensor : replace json values by the value at path, values without path are removed
+func projectHistoSensor(sVals []HistoSensor, path string) (projected []HistoSensor, err error) {
+	keys, err := parseJsonPath(path)
+	if err != nil {
+		return
+	}
+	projected = []HistoSensor{}
+	for _, sVal := range sVals {
+		val, err := jsonPathValue(sVal.Val, keys)
+		if err != nil {
+			continue
+		}
+		projected = append(projected, HistoSensor{sVal.Ts, sVal.IdObject, val})
+	}
+	return
+}
+
 func fctApiReadActorRes(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
 	last := false
 	if (jsonCmde.Startts <= 0 && jsonCmde.Endts <= 0) || jsonCmde.Startts > time.Now().Unix() {
@@ -270,6 +633,49 @@ func fctApiSaveObject(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []b
 		apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
 		return
 	}
+	switch objIn.Fields[0].IdItem {
+	case ItemSensor:
+		if err := checkSensorSchedule(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+		if err := checkSensorTransform(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+		if err := checkSensorFormula(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+		if err := checkSensorFileWatch(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+		if err := checkSensorTimeout(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+	case ItemSensorAct:
+		if err := checkSensorActCondition(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+	case ItemActor:
+		if err := checkActorTimeout(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+	case ItemScene:
+		if err := checkScene(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+	case ItemSchedule:
+		if err := checkSchedule(objIn); err != nil {
+			apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err.Error()))
+			return
+		}
+	}
 
 	// write object to DB
 	objectid, err := writeObject(objIn)
@@ -283,10 +689,20 @@ func fctApiSaveObject(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []b
 	case ItemUser:
 		go loadUsers(nil, true)
 		break
+	case ItemActor:
+		// Actor updated : driver state must be reset
+		CloseObjDriver(ActorFunc, objectid)
+		break
 	case ItemSensor:
-		err = sensorUpdateTicker(objIn)
+		// Reload saved sensor : need its id (on insert) and linked sensorAct
+		sensors, err := getHomeObjects(nil, ItemIdNone, objectid)
+		if err != nil || len(sensors) != 1 {
+			glog.Errorf("fctApiSaveObject : read sensor #%d fail : %s", objectid, err)
+			break
+		}
+		err = sensorUpdateTicker(sensors[0])
 		if err != nil {
-			glog.Errorf("fctApiSaveObject : sensor #%d update failed : %s", objIn.Values[0].IdObject, err)
+			glog.Errorf("fctApiSaveObject : sensor #%d update failed : %s", objectid, err)
 		}
 		break
 	case ItemSensorAct:
@@ -321,6 +737,15 @@ func fctApiSaveObject(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []b
 			glog.Errorf("fctApiSaveObject : sensor %d update failed : %s", masterid, err)
 		}
 		break
+	case ItemSchedule:
+		// Reload saved schedule : need its id (on insert)
+		schedules, err := getHomeObjects(nil, ItemIdNone, objectid)
+		if err != nil || len(schedules) != 1 {
+			glog.Errorf("fctApiSaveObject : read schedule #%d fail : %s", objectid, err)
+			break
+		}
+		scheduleUpdate(schedules[0])
+		break
 	}
 
 	// return saved object
@@ -340,14 +765,174 @@ func fctApiTriggerActor(profil TUserProfil, userId int, jsonCmde apiCommandSruct
 		return
 	}
 
-	result, err := triggerActorById(jsonCmde.Objectid, userId, jsonCmde.Jsonparam)
+	actor, err := getActorById(jsonCmde.Objectid)
 	if err != nil {
 		apiResp = apiError(err.Error())
 		return
 	}
+	param, err := checkActorParam(actor, jsonCmde.Jsonparam)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("%s : %s", jsonCmde.Command, err))
+		return
+	}
 
-	apiResp = apiResponse("response", result)
+	// Sensitive actor : return a token to be confirmed with ConfirmActor
+	if isActorConfirmRequired(actor) {
+		confirm, err := requestActorConfirm(actor, userId, param)
+		if err != nil {
+			apiResp = apiError(err.Error())
+			return
+		}
+		apiResp = apiActorConfirmResponse(confirm)
+		return
+	}
+
+	apiResp = apiActorJobWait(startActorJob(actor, userId, param))
 
 	return
 
 }
+
+// fctApiConfirmActor : confirm (or reject) an actor call asked by TriggerActor
+func fctApiConfirmActor(profil TUserProfil, userId int, jsonCmde apiCommandSruct) (apiResp []byte) {
+	if err := checkAccessToObjectId(profil, jsonCmde.Objectid); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	var param apiConfirmActorParam
+	if err := json.Unmarshal([]byte(jsonCmde.Jsonparam), &param); err != nil {
+		apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+		return
+	}
+
+	job, err := confirmActor(param.Token, jsonCmde.Objectid, userId, param.Reject)
+	if err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	apiResp = apiActorJobWait(job)
+	return
+}
+
+// apiActorJobWait : wait for actor result, slow actor : return running job, result to be read with GetActorJob
+func apiActorJobWait(job *actorJob) (apiResp []byte) {
+	if !job.wait(apiTriggerActorWait) {
+		apiResp = apiActorJobResponse(job.getState())
+		return
+	}
+	if _, err := job.getResult(); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	apiResp = apiActorJobResponse(job.getState())
+	return
+}
+
+// apiActorConfirmResponse : {"response":"Confirmation required","confirm":<confirmation>}
+func apiActorConfirmResponse(confirm ActorConfirm) (apiResp []byte) {
+	jsonConfirm, err := json.Marshal(confirm)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("json.Marshal failed for actor %d confirmation : %s", confirm.IdObject, err))
+		return
+	}
+	apiResp = []byte(fmt.Sprintf(`{"response":"Confirmation required","confirm":%s}`, jsonConfirm))
+	return
+}
+
+// apiActorJobResponse : {"response":<actor result or job status>,"job":<job state>}
+func apiActorJobResponse(state ActorJobState) (apiResp []byte) {
+	response := state.Result
+	switch state.Status {
+	case ActorJobRunning:
+		response = fmt.Sprintf("Running (job #%d)", state.JobId)
+	case ActorJobFailed, ActorJobCancelled, ActorJobTimeout:
+		response = state.Error
+	}
+	jsonMsg, err := json.Marshal(response)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("json.Marshal failed for job #%d response : %s", state.JobId, err))
+		return
+	}
+	jsonJob, err := json.Marshal(state)
+	if err != nil {
+		apiResp = apiError(fmt.Sprintf("json.Marshal failed for job #%d : %s", state.JobId, err))
+		return
+	}
+	apiResp = []byte(fmt.Sprintf(`{"response":%s,"job":%s}`, jsonMsg, jsonJob))
+	return
+}
+
+// fctApiGetActorJob : state of an actor job, waiting for its end if asked (long polling)
+// or state of all jobs (of an actor if Objectid is set)
+func fctApiGetActorJob(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	var param apiActorJobParam
+	if err := json.Unmarshal([]byte(jsonCmde.Jsonparam), &param); err != nil {
+		apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+		return
+	}
+
+	if param.JobId <= 0 {
+		states := []ActorJobState{}
+		for _, state := range getActorJobs() {
+			if jsonCmde.Objectid > 0 && state.IdObject != jsonCmde.Objectid {
+				continue
+			}
+			if checkAccessToObjectId(profil, state.IdObject) == nil {
+				states = append(states, state)
+			}
+		}
+		apiResp, err := json.Marshal(states)
+		if err != nil {
+			apiResp = apiError(fmt.Sprintf("%s failed : %s", jsonCmde.Command, err))
+		}
+		return apiResp
+	}
+
+	job, err := getActorJob(param.JobId)
+	if err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+	if err = checkAccessToObjectId(profil, job.getState().IdObject); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	wait := time.Duration(param.Wait) * time.Second
+	if wait > actorJobMaxWait {
+		wait = actorJobMaxWait
+	}
+	job.wait(wait)
+
+	apiResp = apiActorJobResponse(job.getState())
+	return
+}
+
+// fctApiCancelActorJob : cancel a running actor job
+// An external command is killed, an internal function can't be interrupted (job no longer waits for it)
+func fctApiCancelActorJob(profil TUserProfil, jsonCmde apiCommandSruct) (apiResp []byte) {
+	var param apiActorJobParam
+	if err := json.Unmarshal([]byte(jsonCmde.Jsonparam), &param); err != nil {
+		apiResp = apiError(fmt.Sprintf("%s fail to unmarshal jsonparam (%s) : %s", jsonCmde.Command, jsonCmde.Jsonparam, err))
+		return
+	}
+
+	job, err := getActorJob(param.JobId)
+	if err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+	if err = checkAccessToObjectId(profil, job.getState().IdObject); err != nil {
+		apiResp = apiError(err.Error())
+		return
+	}
+
+	job.Cancel()
+	job.wait(time.Second)
+
+	apiResp = apiActorJobResponse(job.getState())
+	return
+}
@@ -0,0 +1,188 @@
+// computed.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Computed sensors
+//
+// A computed sensor is an internal sensor using the 'Formula' function, its ReadParam is an expression
+// (see expr.go) over other sensors, i.e. :
+//   any window open : sensor("Window1") || sensor("Window2")
+//   daily delta     : sensor("Meter") - sensorAt("Meter", today())
+// Value is computed when a referenced sensor value change (and at each tick if an Interval/Schedule is set),
+// then handled as any other sensor value (record, sensorAct). A referenced sensor without value yet is read
+// directly : the computed sensor read already holds a sensor worker.
+// -----------------------------------------------
+
+const FormulaFunc = "Formula"
+
+// sensorFormulaWatches : by referenced sensor id, the computed sensors to update when that sensor value change
+var sensorFormulaWatchesLock sync.Mutex
+var sensorFormulaWatches = map[int][]int{}
+
+func init() {
+	RegisterInternalFunc(SensorFunc, FormulaFunc, ComputeFormula)
+}
+
+// ComputeFormula : internal sensor function, param1 is the formula
+func ComputeFormula(param1 string, param2 string) (string, error) {
+	prog, err := exprCompile(param1, nil)
+	if err != nil {
+		return "", err
+	}
+	val, err := prog.Eval(exprEnv{})
+	if err != nil {
+		return "", err
+	}
+	return exprFormat(val), nil
+}
+
+// isComputedSensor : check if sensor value is computed with a formula
+func isComputedSensor(sensor HomeObject) bool {
+	return sensor.getOptIntVal("IsInternal", 0) != 0 && sensor.getOptStrVal("ReadCmd", "") == FormulaFunc
+}
+
+// compileSensorFormula : compile computed sensor formula
+func compileSensorFormula(sensor HomeObject) (prog *exprProgram, err error) {
+	formula := strings.TrimSpace(sensor.getOptStrVal("ReadParam", ""))
+	if len(formula) <= 0 {
+		err = errors.New("empty formula")
+		return
+	}
+	return exprCompile(formula, nil)
+}
+
+// checkSensorFormula : check computed sensor formula type and that sensor does not depend on itself
+func checkSensorFormula(sensor HomeObject) (err error) {
+	if !isComputedSensor(sensor) {
+		return
+	}
+	prog, err := compileSensorFormula(sensor)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Formula error : %s", err))
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return
+	}
+	if prog.Type() != exprTypeOf(TDataType(dataType)) {
+		return errors.New(fmt.Sprintf("Formula type (%s) does not match sensor data type (%s)", prog.Type(), exprTypeOf(TDataType(dataType))))
+	}
+
+	// Look for a dependency cycle using registered computed sensors
+	sensorId := sensor.getId()
+	deps := map[int][]int{sensorId: prog.sensorRefs}
+	sensorRegistryLock.Lock()
+	registry := make([]HomeObject, 0, len(sensorRegistry))
+	for id, obj := range sensorRegistry {
+		if id != sensorId {
+			registry = append(registry, obj)
+		}
+	}
+	sensorRegistryLock.Unlock()
+	for _, obj := range registry {
+		if !isComputedSensor(obj) {
+			continue
+		}
+		if objProg, err := compileSensorFormula(obj); err == nil {
+			deps[obj.getId()] = objProg.sensorRefs
+		}
+	}
+
+	visited := map[int]bool{}
+	var dependOn func(id int) bool
+	dependOn = func(id int) bool {
+		for _, refId := range deps[id] {
+			if refId == sensorId {
+				return true
+			}
+			if !visited[refId] {
+				visited[refId] = true
+				if dependOn(refId) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if dependOn(sensorId) {
+		return errors.New("Formula error : sensor depends on itself")
+	}
+	return nil
+}
+
+// sensorUpdateFormulaWatches : rebuild the list of sensors watched by a computed sensor
+func sensorUpdateFormulaWatches(sensor HomeObject) {
+	sensorId := sensor.getId()
+
+	var refs []int
+	if isComputedSensor(sensor) {
+		prog, err := compileSensorFormula(sensor)
+		if err != nil {
+			glog.Errorf("sensorUpdateFormulaWatches %d : %s", sensorId, err)
+		} else {
+			refs = prog.sensorRefs
+		}
+	}
+
+	sensorFormulaWatchesLock.Lock()
+	defer sensorFormulaWatchesLock.Unlock()
+
+	// Remove previous watches for this sensor
+	for refId, list := range sensorFormulaWatches {
+		kept := list[:0]
+		for _, id := range list {
+			if id != sensorId {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) > 0 {
+			sensorFormulaWatches[refId] = kept
+		} else {
+			delete(sensorFormulaWatches, refId)
+		}
+	}
+
+	seen := map[int]bool{sensorId: true}
+	for _, refId := range refs {
+		if !seen[refId] {
+			seen[refId] = true
+			sensorFormulaWatches[refId] = append(sensorFormulaWatches[refId], sensorId)
+		}
+	}
+}
+
+// updateComputedSensors : compute and handle value of active computed sensors using sensorId
+func updateComputedSensors(sensorId int) {
+	sensorFormulaWatchesLock.Lock()
+	ids := append([]int(nil), sensorFormulaWatches[sensorId]...)
+	sensorFormulaWatchesLock.Unlock()
+
+	for _, id := range ids {
+		sensorRegistryLock.Lock()
+		computed, found := sensorRegistry[id]
+		sensorRegistryLock.Unlock()
+		if !found || computed.getOptIntVal("IsActive", 0) == 0 {
+			continue
+		}
+		go func(computed HomeObject) {
+			value, err := readSensorWithWorker(context.Background(), computed)
+			if err != nil {
+				glog.Errorf("updateComputedSensors %d : %s", computed.getId(), err)
+				sensorHealthFailed(computed, err)
+				return
+			}
+			handleSensorValue(time.Now(), computed, value)
+		}(computed)
+	}
+}
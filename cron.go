@@ -0,0 +1,225 @@
+// cron.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------
+
+// cronSchedule : a parsed crontab like schedule "m h dom mon dow"
+//
+// Each field accept : *  n  a-b  */s  a-b/s  n/s  and comma separated lists of these
+// Month and day of week also accept names (jan..dec, sun..sat), 0 or 7 for sunday.
+// Missing trailing fields are "*" (so "0 2 * *" is still a valid schedule)
+// As with cron, if both dom and dow are restricted, a day matching any of them is used.
+// A dom / dow field starting with "*" (i.e. "*/2") is not restricted : "0 8 */2 * mon" is every
+// odd day of month which is a monday (as with Vixie cron).
+// Daylight saving time : a time skipped when clocks go forward does not match that day,
+// a time repeated when clocks go back matches once, unless hour field starts with "*" (i.e. "0 * * *"
+// still matches each hour).
+type cronSchedule struct {
+	src                           string
+	minute, hour, dom, month, dow uint64 // bit i set if value i match
+	anyDom, anyDow, anyHour       bool   // dom / dow / hour field starts with "*"
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // optional names, names[0] is value min
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Max time to look for next matching date/time (i.e. "0 0 30 2 *" never match)
+const cronMaxSearch = 5 * 366 * 24 * time.Hour
+
+// -----------------------------------------------
+
+// parseCronSchedule : parse a crontab like schedule
+func parseCronSchedule(spec string) (sched *cronSchedule, err error) {
+	spec = cleanSpaces(spec)
+	fields := strings.Split(spec, " ")
+	if len(spec) <= 0 || len(fields) > len(cronFields) {
+		err = errors.New(fmt.Sprintf("bad schedule '%s' : expect 1 to %d fields", spec, len(cronFields)))
+		return
+	}
+	for len(fields) < len(cronFields) {
+		fields = append(fields, "*")
+	}
+
+	bits := make([]uint64, len(cronFields))
+	for i, field := range fields {
+		if bits[i], err = cronFields[i].parse(field); err != nil {
+			err = errors.New(fmt.Sprintf("bad schedule '%s' : %s", spec, err))
+			return
+		}
+	}
+	// 7 is also sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	sched = &cronSchedule{spec, bits[0], bits[1], bits[2], bits[3], bits[4],
+		strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*"), strings.HasPrefix(fields[1], "*")}
+	return
+}
+
+// parse : return matching values bits for a field
+func (f cronField) parse(field string) (bits uint64, err error) {
+	for _, part := range strings.Split(strings.ToLower(field), ",") {
+		lo, hi, step := f.min, f.max, 1
+
+		rng := part
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.New(fmt.Sprintf("bad step in %s '%s'", f.name, part))
+			}
+		}
+
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return
+			}
+			if len(bounds) > 1 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return
+				}
+			} else if rng != part {
+				// n/s : from n to max
+				hi = f.max
+			} else {
+				hi = lo
+			}
+			if hi < lo {
+				return 0, errors.New(fmt.Sprintf("bad range in %s '%s'", f.name, part))
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+// value : convert a field value (number or name) to int
+func (f cronField) value(s string) (v int, err error) {
+	for i, name := range f.names {
+		if s == name {
+			return f.min + i, nil
+		}
+	}
+	if v, err = strconv.Atoi(s); err != nil || v < f.min || v > f.max {
+		return 0, errors.New(fmt.Sprintf("bad %s '%s' (%d-%d)", f.name, s, f.min, f.max))
+	}
+	return
+}
+
+// -----------------------------------------------
+
+// dayMatch : check if t day match dom / dow fields
+func (sched *cronSchedule) dayMatch(t time.Time) bool {
+	domOk := sched.dom&(1<<uint(t.Day())) != 0
+	dowOk := sched.dow&(1<<uint(t.Weekday())) != 0
+	if sched.anyDom || sched.anyDow {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// cronWallClock : t date and time (minute resolution) regardless of its zone offset
+func cronWallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// Next : first date/time matching schedule strictly after t (minute resolution)
+func (sched *cronSchedule) Next(t time.Time) (next time.Time, err error) {
+	loc := t.Location()
+	next = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronMaxSearch)
+
+	for next.Before(limit) {
+		if sched.month&(1<<uint(next.Month())) == 0 {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !sched.dayMatch(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if sched.hour&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if sched.minute&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		if !sched.anyHour && !cronWallClock(next).After(cronWallClock(t)) {
+			// clocks went back : same time already matched
+			next = next.Add(time.Minute)
+			continue
+		}
+		return
+	}
+
+	err = errors.New(fmt.Sprintf("schedule '%s' never match", sched.src))
+	return
+}
+
+// -----------------------------------------------
+
+// cronTicker : deliver on channel C the date/time matching a schedule (as a time.Ticker does for a period)
+type cronTicker struct {
+	C    <-chan time.Time
+	stop chan bool
+}
+
+// newCronTicker : start a ticker for schedule
+func newCronTicker(sched *cronSchedule) *cronTicker {
+	c := make(chan time.Time, 1)
+	ticker := &cronTicker{c, make(chan bool)}
+
+	go func() {
+		defer close(c)
+		for {
+			next, err := sched.Next(time.Now())
+			if err != nil {
+				return
+			}
+			timer := time.NewTimer(next.Sub(time.Now()))
+			select {
+			case t := <-timer.C:
+				// drop tick if previous one is still not handled
+				select {
+				case c <- t:
+				default:
+				}
+			case <-ticker.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return ticker
+}
+
+// Stop : stop the ticker and close C
+func (ticker *cronTicker) Stop() {
+	close(ticker.stop)
+}
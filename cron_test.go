@@ -0,0 +1,126 @@
+// cron_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// cronTestNext : successive runs of spec after from, formatted as "2006-01-02 15:04 MST"
+func cronTestNext(t *testing.T, spec string, from time.Time, count int) (runs []string) {
+	sched, err := parseCronSchedule(spec)
+	if err != nil {
+		t.Fatalf("%s : %s", spec, err)
+	}
+	next := from
+	for i := 0; i < count; i++ {
+		if next, err = sched.Next(next); err != nil {
+			t.Fatalf("%s : %s", spec, err)
+		}
+		runs = append(runs, next.Format("2006-01-02 15:04 MST"))
+	}
+	return
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-01-01 is a thursday
+	from := time.Date(2026, time.January, 1, 10, 17, 42, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"* * * * *", []string{"2026-01-01 10:18 UTC", "2026-01-01 10:19 UTC"}},
+		{"0 2", []string{"2026-01-02 02:00 UTC", "2026-01-03 02:00 UTC"}},
+		// steps
+		{"*/20", []string{"2026-01-01 10:20 UTC", "2026-01-01 10:40 UTC", "2026-01-01 11:00 UTC"}},
+		{"10-30/10 9-11", []string{"2026-01-01 10:20 UTC", "2026-01-01 10:30 UTC", "2026-01-01 11:10 UTC"}},
+		{"50/5 */6", []string{"2026-01-01 12:50 UTC", "2026-01-01 12:55 UTC", "2026-01-01 18:50 UTC"}},
+		{"0 0 */10", []string{"2026-01-11 00:00 UTC", "2026-01-21 00:00 UTC", "2026-01-31 00:00 UTC", "2026-02-01 00:00 UTC"}},
+		{"0,30 8 * * 1-5", []string{"2026-01-02 08:00 UTC", "2026-01-02 08:30 UTC", "2026-01-05 08:00 UTC"}},
+		// names, 7 is sunday
+		{"0 12 * feb-mar sun", []string{"2026-02-01 12:00 UTC", "2026-02-08 12:00 UTC"}},
+		{"0 12 * * 7", []string{"2026-01-04 12:00 UTC", "2026-01-11 12:00 UTC"}},
+		// dom and dow both restricted : any of them
+		{"0 8 13 * fri", []string{"2026-01-02 08:00 UTC", "2026-01-09 08:00 UTC", "2026-01-13 08:00 UTC", "2026-01-16 08:00 UTC"}},
+		// dom step starting with "*" is not restricted : both must match (odd days which are a monday)
+		{"0 8 */2 * mon", []string{"2026-01-05 08:00 UTC", "2026-01-19 08:00 UTC", "2026-02-09 08:00 UTC"}},
+		// dow step starting with "*" is not restricted : both must match (13th which is a sun, tue, thu or sat)
+		{"0 8 13 * */2", []string{"2026-01-13 08:00 UTC", "2026-06-13 08:00 UTC", "2026-08-13 08:00 UTC"}},
+		// month end : months without day 31 are skipped, february 29 only on leap years
+		{"0 0 31", []string{"2026-01-31 00:00 UTC", "2026-03-31 00:00 UTC", "2026-05-31 00:00 UTC", "2026-07-31 00:00 UTC", "2026-08-31 00:00 UTC"}},
+		{"0 0 29 2", []string{"2028-02-29 00:00 UTC", "2032-02-29 00:00 UTC"}},
+		{"59 23 30-31 12", []string{"2026-12-30 23:59 UTC", "2026-12-31 23:59 UTC", "2027-12-30 23:59 UTC"}},
+	}
+	for _, tt := range tests {
+		got := cronTestNext(t, tt.spec, from, len(tt.want))
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s :\n got  %v\n want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCronDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone data : ", err)
+	}
+	tests := []struct {
+		spec string
+		from time.Time
+		want []string
+	}{
+		// clocks go forward 2026-03-29 02:00 CET -> 03:00 CEST : 02:30 is skipped that day
+		{"30 2", time.Date(2026, time.March, 28, 12, 0, 0, 0, loc), []string{"2026-03-30 02:30 CEST", "2026-03-31 02:30 CEST"}},
+		{"0 *", time.Date(2026, time.March, 29, 0, 30, 0, 0, loc), []string{"2026-03-29 01:00 CET", "2026-03-29 03:00 CEST", "2026-03-29 04:00 CEST"}},
+		{"*/30 1-3", time.Date(2026, time.March, 29, 1, 10, 0, 0, loc), []string{"2026-03-29 01:30 CET", "2026-03-29 03:00 CEST", "2026-03-29 03:30 CEST"}},
+		// clocks go back 2026-10-25 03:00 CEST -> 02:00 CET : 02:30 matches once
+		{"30 2", time.Date(2026, time.October, 24, 12, 0, 0, 0, loc), []string{"2026-10-25 02:30 CET", "2026-10-26 02:30 CET"}},
+		{"30 2", time.Date(2026, time.October, 25, 2, 10, 0, 0, time.FixedZone("CEST", 2*3600)).In(loc), []string{"2026-10-25 02:30 CEST", "2026-10-26 02:30 CET"}},
+		// hour field starting with "*" : repeated hour matches twice
+		{"15 *", time.Date(2026, time.October, 25, 1, 30, 0, 0, loc), []string{"2026-10-25 02:15 CEST", "2026-10-25 02:15 CET", "2026-10-25 03:15 CET"}},
+	}
+	for _, tt := range tests {
+		got := cronTestNext(t, tt.spec, tt.from, len(tt.want))
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s from %v :\n got  %v\n want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronParseError(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"", "expect 1 to 5 fields"},
+		{"* * * * * *", "expect 1 to 5 fields"},
+		{"60", "bad minute '60' (0-59)"},
+		{"* 24", "bad hour '24' (0-23)"},
+		{"* * 0", "bad day of month '0' (1-31)"},
+		{"* * * 13", "bad month '13' (1-12)"},
+		{"* * * foo", "bad month 'foo'"},
+		{"* * * * 8", "bad day of week '8' (0-7)"},
+		{"*/0", "bad step in minute '*/0'"},
+		{"*/x", "bad step in minute '*/x'"},
+		{"30-10", "bad range in minute '30-10'"},
+	}
+	for _, tt := range tests {
+		_, err := parseCronSchedule(tt.spec)
+		if err == nil {
+			t.Errorf("'%s' : no error, want '%s'", tt.spec, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("'%s' : error '%s', want '%s'", tt.spec, err, tt.err)
+		}
+	}
+
+	sched, err := parseCronSchedule("0 0 30 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sched.Next(time.Now()); err == nil || !strings.Contains(err.Error(), "never match") {
+		t.Errorf("'0 0 30 2' : %v, want never match", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +37,8 @@ const (
 	ItemActor
 	ItemSensorAct
 	ItemImageSensor
+	ItemScene
+	ItemSchedule
 )
 
 type Item struct {
@@ -72,12 +75,27 @@ type HistoSensor struct {
 	Val      string
 }
 
+// HistoRollup : summary of sensor values for a time bucket [Ts, Ts+Resolution[ (a local day for daily rollups)
+// Val is the average value (as in HistoSensor)
+type HistoRollup struct {
+	Ts         time.Time
+	IdObject   int
+	Resolution int64
+	Val        string
+	Min        float64
+	Max        float64
+	Nb         int
+}
+
 type HistoActor struct {
-	Ts       time.Time
+	Ts       time.Time // start time
 	IdObject int
 	IdUser   int
 	Param    string
 	Res      string
+	End      time.Time
+	Duration int64  // in ms
+	Status   string // final job status (empty for results recorded before actor jobs)
 }
 
 // -----------------------------------------------
@@ -560,6 +578,58 @@ func getLinkedObjIds(db *sql.DB, idObject int) (lstId []int, err error) {
 // -----------------------------------------------
 // -----------------------------------------------
 
+// getHistoSensorAt : read the last value from HistoSensor with ts <= t
+func getHistoSensorAt(db *sql.DB, idObject int, t time.Time) (value HistoSensor, found bool, err error) {
+	if db == nil {
+		if db, err = openDB(); err != nil {
+			return
+		}
+		defer db.Close()
+	}
+
+	err = db.QueryRow("select h.ts, h.idObject, h.Val from HistoSensor h where h.idObject = ? and h.ts <= ? order by h.ts desc limit 1", idObject, t.Unix()).Scan(&value.Ts, &value.IdObject, &value.Val)
+	if err == sql.ErrNoRows {
+		return value, false, nil
+	}
+	if err != nil {
+		glog.Errorf("getHistoSensorAt fail (obj=%d,t=%s) : %s ", idObject, t, err)
+		return
+	}
+	return value, true, nil
+}
+
+// getSensorLastVal : read the last value kept in SensorLastVal for a sensor not recording its values
+func getSensorLastVal(db *sql.DB, idObject int) (value HistoSensor, found bool, err error) {
+	err = db.QueryRow("select l.ts, l.idObject, l.Val from SensorLastVal l where l.idObject = ?", idObject).Scan(&value.Ts, &value.IdObject, &value.Val)
+	if err == sql.ErrNoRows {
+		return value, false, nil
+	}
+	if err != nil {
+		glog.Errorf("getSensorLastVal fail (obj=%d) : %s ", idObject, err)
+		return
+	}
+	return value, true, nil
+}
+
+// countHistoSensor : nb of values in HistoSensor between [startTS and endTS] (as getHistoSensor)
+func countHistoSensor(db *sql.DB, idObject int, startTS time.Time, endTS time.Time) (nb int, err error) {
+	if db == nil {
+		if db, err = openDB(); err != nil {
+			return
+		}
+		defer db.Close()
+	}
+	if endTS.Before(time.Date(2016, time.January, 1, 0, 0, 0, 0, time.Local)) {
+		endTS = time.Now()
+	}
+
+	err = db.QueryRow("select count(*) from HistoSensor h where h.idObject = ? and h.ts between ? and ?", idObject, startTS.Unix(), endTS.Unix()).Scan(&nb)
+	if err != nil {
+		glog.Errorf("countHistoSensor fail (obj=%d,start=%s,end=%s) : %s ", idObject, startTS, endTS, err)
+	}
+	return
+}
+
 // getHistoSensor : read values from HistoSensor
 // if last the return the last available value (with greater timestamp)
 // else return all values between [startTS and endTS] (if endTS <= 2016/01/01 returns all values with ts >= startTS)
@@ -607,6 +677,78 @@ func getHistoSensor(db *sql.DB, idObject int, last bool, startTS time.Time, endT
 // -----------------------------------------------
 // -----------------------------------------------
 
+// getHistoRollup : read rollups of given resolution from HistoRollup with ts between [startTS and endTS]
+// (if endTS <= 2016/01/01 returns all rollups with ts >= startTS)
+func getHistoRollup(db *sql.DB, idObject int, resolution int64, startTS time.Time, endTS time.Time) (values []HistoRollup, err error) {
+	if db == nil {
+		if db, err = openDB(); err != nil {
+			return
+		}
+		defer db.Close()
+	}
+
+	if endTS.Before(time.Date(2016, time.January, 1, 0, 0, 0, 0, time.Local)) {
+		endTS = time.Now()
+	}
+	rows, err := db.Query("select cast(h.ts as integer), h.idObject, h.resolution, h.avgVal, h.minVal, h.maxVal, h.nbVal from HistoRollup h where h.idObject = ? and h.resolution = ? and h.ts between ? and ? order by h.ts",
+		idObject, resolution, startTS.Unix(), endTS.Unix())
+	if err != nil {
+		glog.Errorf("getHistoRollup query fail (obj=%d,res=%d,start=%s,end=%s) : %s ", idObject, resolution, startTS, endTS, err)
+		return
+	}
+	defer rows.Close()
+
+	if values, err = scanHistoRollup(rows); err != nil {
+		glog.Errorf("getHistoRollup fail (obj=%d,res=%d,start=%s,end=%s) : %s ", idObject, resolution, startTS, endTS, err)
+	}
+	return
+}
+
+// summarizeHistoSensor : summarize values from HistoSensor with ts between [startTS and endTS] as rollups of given
+// resolution, for a range not rolled up yet (see histo.go)
+func summarizeHistoSensor(db *sql.DB, idObject int, resolution int64, startTS time.Time, endTS time.Time) (values []HistoRollup, err error) {
+	if db == nil {
+		if db, err = openDB(); err != nil {
+			return
+		}
+		defer db.Close()
+	}
+
+	bucket := histoBucketExpr(resolution)
+	rows, err := db.Query("select "+bucket+", idObject, ?, avg(cast(Val as real)), min(cast(Val as real)), max(cast(Val as real)), count(*) from HistoSensor where idObject = ? and ts between ? and ? group by "+bucket+" order by 1",
+		resolution, idObject, startTS.Unix(), endTS.Unix())
+	if err != nil {
+		glog.Errorf("summarizeHistoSensor query fail (obj=%d,res=%d,start=%s,end=%s) : %s ", idObject, resolution, startTS, endTS, err)
+		return
+	}
+	defer rows.Close()
+
+	if values, err = scanHistoRollup(rows); err != nil {
+		glog.Errorf("summarizeHistoSensor fail (obj=%d,res=%d,start=%s,end=%s) : %s ", idObject, resolution, startTS, endTS, err)
+	}
+	return
+}
+
+// scanHistoRollup : read rollups (ts, idObject, resolution, avg, min, max, nb) from rows
+func scanHistoRollup(rows *sql.Rows) (values []HistoRollup, err error) {
+	for rows.Next() {
+		var curVal HistoRollup
+		var ts int64
+		var avg float64
+		if err = rows.Scan(&ts, &curVal.IdObject, &curVal.Resolution, &avg, &curVal.Min, &curVal.Max, &curVal.Nb); err != nil {
+			return
+		}
+		curVal.Ts = time.Unix(ts, 0)
+		curVal.Val = strconv.FormatFloat(avg, 'f', -1, 64)
+		values = append(values, curVal)
+	}
+	err = rows.Err()
+	return
+}
+
+// -----------------------------------------------
+// -----------------------------------------------
+
 // getHistActor : read values from HistoActor
 // if last the return the last available value (with greater timestamp)
 // else return all values between [startTS and endTS] (if endTS <= 2016/01/01 returns all values with ts >= startTS)
@@ -621,12 +763,12 @@ func getHistActor(db *sql.DB, idObject int, last bool, startTS time.Time, endTS
 	var rows *sql.Rows
 
 	if last {
-		rows, err = db.Query("select h.ts, h.idObject, h.idUser, h.Param, h.Res from HistoActor h where h.idObject = ? group by h.idObject having h.ts = max(h.ts)", idObject)
+		rows, err = db.Query("select h.ts, h.idObject, h.idUser, h.Param, h.Res, ifnull(h.endTs, h.ts), ifnull(h.duration, 0), ifnull(h.status, '') from HistoActor h where h.idObject = ? group by h.idObject having h.ts = max(h.ts)", idObject)
 	} else {
 		if endTS.Before(time.Date(2016, time.January, 1, 0, 0, 0, 0, time.Local)) {
 			endTS = time.Now()
 		}
-		rows, err = db.Query("select h.ts, h.idObject, h.idUser, h.Param, h.Res from HistoActor h where h.idObject = ? and h.ts between ? and ? order by h.ts", idObject, startTS.Unix(), endTS.Unix())
+		rows, err = db.Query("select h.ts, h.idObject, h.idUser, h.Param, h.Res, ifnull(h.endTs, h.ts), ifnull(h.duration, 0), ifnull(h.status, '') from HistoActor h where h.idObject = ? and h.ts between ? and ? order by h.ts", idObject, startTS.Unix(), endTS.Unix())
 	}
 	if err != nil {
 		glog.Errorf("getHistActor query fail (obj=%d,last=%d,start=%s,end=%s) : %s ", idObject, last, startTS, endTS, err)
@@ -636,11 +778,13 @@ func getHistActor(db *sql.DB, idObject int, last bool, startTS time.Time, endTS
 
 	for rows.Next() {
 		var curVal HistoActor
-		err = rows.Scan(&curVal.Ts, &curVal.IdObject, &curVal.IdUser, &curVal.Param, &curVal.Res)
+		var end int64
+		err = rows.Scan(&curVal.Ts, &curVal.IdObject, &curVal.IdUser, &curVal.Param, &curVal.Res, &end, &curVal.Duration, &curVal.Status)
 		if err != nil {
 			glog.Errorf("getHistActor scan fail (obj=%d,last=%d,start=%s,end=%s) : %s ", idObject, last, startTS, endTS, err)
 			return
 		}
+		curVal.End = time.Unix(end, 0)
 		values = append(values, curVal)
 	}
 	if err = rows.Err(); err != nil {
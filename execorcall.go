@@ -2,14 +2,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 )
 
 // -----------------------------------------------
+// Internal sensor and actor functions
+//
+// A driver is created for each sensor / actor object using it (on first call) and kept until the object
+// ReadCmd/ActCmd or ReadParam/ActParam change, the object is updated or goHome stops (then Close is called).
+// A driver receive a context (with a deadline), the calling object and its parameters decoded from
+// ReadParam/ActParam (json decoded in DriverInfo.Params if set, else raw string).
+//
+// Simple functions func(param1, param2 string) (string, error) registered with RegisterInternalFunc
+// are called through funcDriver : param1 is ReadParam/ActParam, param2 the dynamic parameter.
 // -----------------------------------------------
 
 type internalFuncType int
@@ -19,15 +32,46 @@ const (
 	ActorFunc
 )
 
+// driverCallTimeout : deadline for a driver call
+const driverCallTimeout = 30 * time.Second
+
+// Driver : internal sensor or actor implementation for one object
+type Driver interface {
+	// Call : read sensor value or trigger actor, param is the dynamic parameter (empty for a sensor)
+	Call(ctx context.Context, obj HomeObject, param string) (string, error)
+	// Close : release driver resources
+	Close() error
+}
+
+// DriverInfo : how to create a driver for an object
+type DriverInfo struct {
+	Params func() interface{}                                       // new params (pointer to struct), nil to get raw string params
+	New    func(obj HomeObject, params interface{}) (Driver, error) // create driver for obj
+}
+
+// driverInstance : a driver created for an object with given function and params
+type driverInstance struct {
+	funcName string
+	params   string
+	driver   Driver
+}
+
 var internalFuncsLock sync.Mutex
-var internalFuncs = map[string]func(string, string) (string, error){}
+var internalFuncs = map[string]DriverInfo{}
+
+var driverInstancesLock sync.Mutex
+var driverInstances = map[string]*driverInstance{}
 
 func getFuncKey(funcType internalFuncType, funcName string) string {
 	return fmt.Sprintf("%d %s", funcType, funcName)
 }
 
-// RegisterInternalFunc : Add a function so it can be call as a sensor or actor
-func RegisterInternalFunc(funcType internalFuncType, funcName string, function func(string, string) (string, error)) error {
+func getInstanceKey(funcType internalFuncType, objId int) string {
+	return fmt.Sprintf("%d %d", funcType, objId)
+}
+
+// RegisterDriver : Add a driver so it can be call as a sensor or actor
+func RegisterDriver(funcType internalFuncType, funcName string, info DriverInfo) error {
 	fctKey := getFuncKey(funcType, funcName)
 
 	internalFuncsLock.Lock()
@@ -40,30 +84,173 @@ func RegisterInternalFunc(funcType internalFuncType, funcName string, function f
 		return err
 	}
 
-	internalFuncs[fctKey] = function
+	internalFuncs[fctKey] = info
 
 	return nil
 }
 
-// CallInternalFunc : Call an existing registered func
-func CallInternalFunc(funcType internalFuncType, funcName string, param1 string, param2 string) (string, error) {
+// RegisterInternalFunc : Add a function so it can be call as a sensor or actor
+func RegisterInternalFunc(funcType internalFuncType, funcName string, function func(string, string) (string, error)) error {
+	return RegisterDriver(funcType, funcName, DriverInfo{
+		New: func(obj HomeObject, params interface{}) (Driver, error) {
+			return funcDriver{function: function, param1: params.(string)}, nil
+		},
+	})
+}
+
+// funcDriver : adapter for functions registered with RegisterInternalFunc
+type funcDriver struct {
+	function func(string, string) (string, error)
+	param1   string
+}
+
+func (d funcDriver) Call(ctx context.Context, obj HomeObject, param string) (string, error) {
+	type callRes struct {
+		result string
+		err    error
+	}
+	// Function can't be interrupted : not started if ctx is already done, else stop waiting for it when ctx is done
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	resChan := make(chan callRes, 1)
+	go func() {
+		result, err := d.function(d.param1, param)
+		resChan <- callRes{result, err}
+	}()
+	select {
+	case res := <-resChan:
+		return res.result, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (d funcDriver) Close() error {
+	return nil
+}
+
+// newDriver : create a driver using registered function funcName and params
+func newDriver(funcType internalFuncType, funcName string, obj HomeObject, params string) (Driver, error) {
 	fctKey := getFuncKey(funcType, funcName)
 
 	internalFuncsLock.Lock()
-	function, funcExist := internalFuncs[fctKey]
+	info, funcExist := internalFuncs[fctKey]
 	internalFuncsLock.Unlock()
 
 	if !funcExist {
 		err := errors.New(fmt.Sprintf("Function '%s' unknown", fctKey))
 		glog.Error(err)
+		return nil, err
+	}
+
+	var decoded interface{} = params
+	if info.Params != nil {
+		decoded = info.Params()
+		if len(strings.TrimSpace(params)) > 0 {
+			if err := json.Unmarshal([]byte(params), decoded); err != nil {
+				return nil, errors.New(fmt.Sprintf("%s : fail to unmarshal param '%s' : %s", funcName, params, err))
+			}
+		}
+	}
+	return info.New(obj, decoded)
+}
+
+// getObjDriver : driver for an object, created if needed (or if function / params changed)
+func getObjDriver(funcType internalFuncType, funcName string, obj HomeObject, params string) (Driver, error) {
+	key := getInstanceKey(funcType, obj.getId())
+
+	driverInstancesLock.Lock()
+	defer driverInstancesLock.Unlock()
+
+	instance, found := driverInstances[key]
+	if found && instance.funcName == funcName && instance.params == params {
+		return instance.driver, nil
+	}
+	if found {
+		closeDriver(key, instance)
+	}
+
+	driver, err := newDriver(funcType, funcName, obj, params)
+	if err != nil {
+		return nil, err
+	}
+	driverInstances[key] = &driverInstance{funcName: funcName, params: params, driver: driver}
+	return driver, nil
+}
+
+// closeDriver : close and remove a driver instance, driverInstancesLock must be held
+func closeDriver(key string, instance *driverInstance) {
+	if err := instance.driver.Close(); err != nil {
+		glog.Errorf("Close driver %s (%s) : %s", instance.funcName, key, err)
+	}
+	delete(driverInstances, key)
+}
+
+// CloseObjDriver : close driver of an object if any (object updated or removed)
+func CloseObjDriver(funcType internalFuncType, objId int) {
+	key := getInstanceKey(funcType, objId)
+
+	driverInstancesLock.Lock()
+	defer driverInstancesLock.Unlock()
+
+	if instance, found := driverInstances[key]; found {
+		closeDriver(key, instance)
+	}
+}
+
+// driverCleanup : close all drivers
+func driverCleanup() {
+	driverInstancesLock.Lock()
+	for key, instance := range driverInstances {
+		closeDriver(key, instance)
+	}
+	driverInstancesLock.Unlock()
+	if glog.V(1) {
+		glog.Info("driverCleanup Done")
+	}
+}
+
+// CallObjFunc : Call registered func funcName for obj (sensor or actor), using obj driver
+// driverCallTimeout is used if ctx has no deadline
+func CallObjFunc(ctx context.Context, funcType internalFuncType, funcName string, obj HomeObject, params string, param string) (string, error) {
+	if len(obj.Values) <= 0 || obj.getId() <= 0 {
+		// object not saved yet
+		return CallInternalFunc(funcType, funcName, params, param)
+	}
+
+	driver, err := getObjDriver(funcType, funcName, obj, params)
+	if err != nil {
 		return "", err
 	}
 
+	if glog.V(2) {
+		glog.Infof("CallObjFunc : %d %s(\"%s\",\"%s\")", obj.getId(), funcName, params, param)
+	}
+
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, driverCallTimeout)
+		defer cancel()
+	}
+	return driver.Call(ctx, obj, param)
+}
+
+// CallInternalFunc : Call an existing registered func, without object (driver created for this call only)
+func CallInternalFunc(funcType internalFuncType, funcName string, param1 string, param2 string) (string, error) {
+	driver, err := newDriver(funcType, funcName, HomeObject{}, param1)
+	if err != nil {
+		return "", err
+	}
+	defer driver.Close()
+
 	if glog.V(2) {
 		glog.Infof("CallInternalFunc : %s(\"%s\",\"%s\")", funcName, param1, param2)
 	}
 
-	return function(param1, param2)
+	ctx, cancel := context.WithTimeout(context.Background(), driverCallTimeout)
+	defer cancel()
+	return driver.Call(ctx, HomeObject{}, param2)
 }
 
 // -----------------------------------------------
@@ -71,9 +258,14 @@ func CallInternalFunc(funcType internalFuncType, funcName string, param1 string,
 
 // ExecExternalCmd : cmd param1 param2
 func ExecExternalCmd(cmd string, param1 string, param2 string) (result string, err error) {
+	return ExecExternalCmdContext(context.Background(), cmd, param1, param2)
+}
+
+// ExecExternalCmdContext : cmd param1 param2, killed when ctx is done
+func ExecExternalCmdContext(ctx context.Context, cmd string, param1 string, param2 string) (result string, err error) {
 
 	cmd = fmt.Sprintf("%s %s %s", cmd, param1, param2)
-	result, err = execCommand(cmd)
+	result, err = execCommandContext(ctx, cmd)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,989 @@
+// expr.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -----------------------------------------------
+// Expression language used for SensorAct conditions
+//
+// Literals  : 12  3.5  "text"  'text'  true  false
+// Variables : @name@ (i.e. @lastVal@, @prevVal@, @sensorName@)
+//             @name.path@ value at path in a json variable (i.e. @lastVal.temp@, @lastVal.probes[0].hum@)
+//             its type is the json value type (number, string or bool), checked at eval time against the
+//             type required by the expression (the other operand type, number if both are json values).
+//             A json string holding a number is accepted as a number.
+// Sensors   : sensor("name") last value of any sensor (name must be a string literal)
+//             sensorAt("name", ts) last recorded value of a sensor at unix time ts (i.e. sensorAt("Meter", today()))
+// Operators : || or  && and  ! not  == != < <= > >=  + - * / %  ( )
+// Functions : see exprFuncs
+//
+// Expressions are type checked at compile time (bool, number or string), no implicit conversion
+// -----------------------------------------------
+
+type exprType int
+
+const (
+	exprNone exprType = iota
+	exprBool
+	exprNumber
+	exprString
+	exprAny // json sub-field, type known at eval time
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprBool:
+		return "bool"
+	case exprNumber:
+		return "number"
+	case exprString:
+		return "string"
+	case exprAny:
+		return "json value"
+	}
+	return "none"
+}
+
+// exprEnv : run time environment for expression evaluation
+type exprEnv struct {
+	now    time.Time
+	vars   map[string]interface{}
+	replay bool // sensor() returns value at time now (from HistoSensor)
+}
+
+// exprProgram : a compiled expression
+type exprProgram struct {
+	src        string
+	root       exprNode
+	sensorRefs []int // Id of sensors used with sensor("name")
+}
+
+// Type : expression result type
+func (p *exprProgram) Type() exprType {
+	return p.root.typ()
+}
+
+// Eval : evaluate compiled expression, result is a bool, a float64 or a string
+func (p *exprProgram) Eval(env exprEnv) (interface{}, error) {
+	if env.now.IsZero() {
+		env.now = time.Now()
+	}
+	return p.root.eval(&env)
+}
+
+// EvalBool : evaluate a compiled bool expression
+func (p *exprProgram) EvalBool(env exprEnv) (bool, error) {
+	if p.Type() != exprBool {
+		return false, errors.New(fmt.Sprintf("'%s' is not a bool expression (%s)", p.src, p.Type()))
+	}
+	res, err := p.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+// exprCompile : parse and type check src, vars give the type of each available variable
+func exprCompile(src string, vars map[string]exprType) (prog *exprProgram, err error) {
+	tokens, err := exprScan(src)
+	if err != nil {
+		return
+	}
+	p := exprParser{tokens: tokens, vars: vars}
+	root, err := p.parseOr()
+	if err != nil {
+		return
+	}
+	if p.peek().kind != tokEOF {
+		err = p.errorf(p.peek(), "unexpected '%s'", p.peek().text)
+		return
+	}
+	prog = &exprProgram{src, root, p.sensorRefs}
+	return
+}
+
+// exprTypeOf : expression type matching a sensor data type
+func exprTypeOf(dataType TDataType) exprType {
+	switch dataType {
+	case DBTypeBool:
+		return exprBool
+	case DBTypeInt, DBTypeFloat, DBTypeDateTime:
+		return exprNumber
+	}
+	return exprString
+}
+
+// exprValueOf : convert a sensor value to an expression value according to sensor data type
+func exprValueOf(dataType TDataType, value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	switch exprTypeOf(dataType) {
+	case exprBool:
+		return strconv.ParseBool(value)
+	case exprNumber:
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
+
+// exprFormat : convert an expression value to string
+func exprFormat(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// -----------------------------------------------
+// Scanner
+// -----------------------------------------------
+
+type exprTokKind int
+
+const (
+	tokEOF exprTokKind = iota
+	tokNumber
+	tokString
+	tokVar
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind exprTokKind
+	text string
+	pos  int
+}
+
+var exprOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func exprScan(src string) (tokens []exprToken, err error) {
+	i := 0
+	for i < len(src) {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case c == utf8.RuneError && size <= 1:
+			err = errors.New(fmt.Sprintf("col %d : invalid utf-8 character", i+1))
+			return
+
+		case unicode.IsSpace(c):
+			i += size
+
+		case exprIsDigit(src[i]) || (c == '.' && i+1 < len(src) && exprIsDigit(src[i+1])):
+			start := i
+			for i < len(src) && (exprIsDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokNumber, src[start:i], start})
+
+		case c == '"' || c == '\'':
+			start := i
+			var str []byte
+			i++
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						str = append(str, '\n')
+					case 't':
+						str = append(str, '\t')
+					default:
+						str = append(str, src[i])
+					}
+				} else {
+					str = append(str, src[i])
+				}
+				i++
+			}
+			if i >= len(src) {
+				err = errors.New(fmt.Sprintf("col %d : unterminated string", start+1))
+				return
+			}
+			i++
+			tokens = append(tokens, exprToken{tokString, string(str), start})
+
+		case c == '@':
+			start := i
+			end := strings.IndexByte(src[i+1:], '@')
+			if end < 0 {
+				err = errors.New(fmt.Sprintf("col %d : missing closing '@' for variable", start+1))
+				return
+			}
+			name := src[i+1 : i+1+end]
+			if len(name) <= 0 {
+				err = errors.New(fmt.Sprintf("col %d : empty variable name", start+1))
+				return
+			}
+			i += end + 2
+			tokens = append(tokens, exprToken{tokVar, name, start})
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) {
+				r, n := utf8.DecodeRuneInString(src[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				i += n
+			}
+			word := src[start:i]
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, exprToken{tokOp, "&&", start})
+			case "or":
+				tokens = append(tokens, exprToken{tokOp, "||", start})
+			case "not":
+				tokens = append(tokens, exprToken{tokOp, "!", start})
+			default:
+				tokens = append(tokens, exprToken{tokIdent, word, start})
+			}
+
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, exprToken{tokOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				if c == '=' {
+					err = errors.New(fmt.Sprintf("col %d : unexpected '=' (use '==' for comparison)", i+1))
+				} else {
+					err = errors.New(fmt.Sprintf("col %d : unexpected character '%c'", i+1, c))
+				}
+				return
+			}
+		}
+	}
+	tokens = append(tokens, exprToken{tokEOF, "end of expression", len(src)})
+	return
+}
+
+// exprIsDigit : ascii digit (number literals only use ascii digits)
+func exprIsDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// -----------------------------------------------
+// Parser
+// -----------------------------------------------
+
+type exprParser struct {
+	tokens     []exprToken
+	cur        int
+	vars       map[string]exprType
+	sensorRefs []int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.cur]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.cur]
+	if tok.kind != tokEOF {
+		p.cur++
+	}
+	return tok
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.errorf(p.peek(), "expecting '%s', got '%s'", op, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, a ...interface{}) error {
+	return errors.New(fmt.Sprintf("col %d : %s", tok.pos+1, fmt.Sprintf(format, a...)))
+}
+
+func (p *exprParser) parseOr() (node exprNode, err error) {
+	if node, err = p.parseAnd(); err != nil {
+		return
+	}
+	for p.isOp("||") {
+		tok := p.next()
+		var right exprNode
+		if right, err = p.parseAnd(); err != nil {
+			return
+		}
+		node, right = exprAs(node, exprBool), exprAs(right, exprBool)
+		if node.typ() != exprBool || right.typ() != exprBool {
+			return nil, p.errorf(tok, "'||' needs bool operands, got %s and %s", node.typ(), right.typ())
+		}
+		node = &exprLogical{"||", node, right}
+	}
+	return
+}
+
+func (p *exprParser) parseAnd() (node exprNode, err error) {
+	if node, err = p.parseCompare(); err != nil {
+		return
+	}
+	for p.isOp("&&") {
+		tok := p.next()
+		var right exprNode
+		if right, err = p.parseCompare(); err != nil {
+			return
+		}
+		node, right = exprAs(node, exprBool), exprAs(right, exprBool)
+		if node.typ() != exprBool || right.typ() != exprBool {
+			return nil, p.errorf(tok, "'&&' needs bool operands, got %s and %s", node.typ(), right.typ())
+		}
+		node = &exprLogical{"&&", node, right}
+	}
+	return
+}
+
+func (p *exprParser) parseCompare() (node exprNode, err error) {
+	if node, err = p.parseAdd(); err != nil {
+		return
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		tok := p.next()
+		var right exprNode
+		if right, err = p.parseAdd(); err != nil {
+			return
+		}
+		if node.typ() != exprAny || right.typ() != exprAny || (tok.text != "==" && tok.text != "!=") {
+			// two json values are compared for equality as is
+			node, right = exprUnify(node, right, exprNumber)
+		}
+		if node.typ() != right.typ() {
+			return nil, p.errorf(tok, "can't compare %s with %s", node.typ(), right.typ())
+		}
+		if node.typ() == exprBool && tok.text != "==" && tok.text != "!=" {
+			return nil, p.errorf(tok, "'%s' not allowed on bool", tok.text)
+		}
+		node = &exprCompare{tok.text, node, right}
+	}
+	return
+}
+
+func (p *exprParser) parseAdd() (node exprNode, err error) {
+	if node, err = p.parseMul(); err != nil {
+		return
+	}
+	for p.isOp("+", "-") {
+		tok := p.next()
+		var right exprNode
+		if right, err = p.parseMul(); err != nil {
+			return
+		}
+		node, right = exprUnify(node, right, exprNumber)
+		switch {
+		case node.typ() == exprNumber && right.typ() == exprNumber:
+		case tok.text == "+" && node.typ() == exprString && right.typ() == exprString:
+		default:
+			return nil, p.errorf(tok, "'%s' not allowed between %s and %s", tok.text, node.typ(), right.typ())
+		}
+		node = &exprArith{tok.text, node, right}
+	}
+	return
+}
+
+func (p *exprParser) parseMul() (node exprNode, err error) {
+	if node, err = p.parseUnary(); err != nil {
+		return
+	}
+	for p.isOp("*", "/", "%") {
+		tok := p.next()
+		var right exprNode
+		if right, err = p.parseUnary(); err != nil {
+			return
+		}
+		node, right = exprAs(node, exprNumber), exprAs(right, exprNumber)
+		if node.typ() != exprNumber || right.typ() != exprNumber {
+			return nil, p.errorf(tok, "'%s' needs number operands, got %s and %s", tok.text, node.typ(), right.typ())
+		}
+		node = &exprArith{tok.text, node, right}
+	}
+	return
+}
+
+func (p *exprParser) parseUnary() (node exprNode, err error) {
+	if p.isOp("!", "-") {
+		tok := p.next()
+		if node, err = p.parseUnary(); err != nil {
+			return
+		}
+		if tok.text == "!" {
+			node = exprAs(node, exprBool)
+		} else {
+			node = exprAs(node, exprNumber)
+		}
+		if tok.text == "!" && node.typ() != exprBool {
+			return nil, p.errorf(tok, "'!' needs a bool operand, got %s", node.typ())
+		}
+		if tok.text == "-" && node.typ() != exprNumber {
+			return nil, p.errorf(tok, "'-' needs a number operand, got %s", node.typ())
+		}
+		node = &exprUnary{tok.text, node}
+		return
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (node exprNode, err error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "bad number '%s'", tok.text)
+		}
+		return &exprConst{n}, nil
+
+	case tokString:
+		return &exprConst{tok.text}, nil
+
+	case tokVar:
+		if t, found := p.vars[tok.text]; found {
+			return &exprVar{tok.text, t, nil}, nil
+		}
+		// Sub-field of a json variable : vars define "name.*" for json variables
+		if dot := strings.Index(tok.text, "."); dot > 0 {
+			if t, found := p.vars[tok.text[:dot]+".*"]; found {
+				path, err := parseJsonPath(tok.text[dot+1:])
+				if err != nil {
+					return nil, p.errorf(tok, "%s", err)
+				}
+				return &exprVar{tok.text[:dot], t, path}, nil
+			}
+		}
+		return nil, p.errorf(tok, "unknown variable '@%s@'", tok.text)
+
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return &exprConst{true}, nil
+		case "false":
+			return &exprConst{false}, nil
+		}
+		return p.parseCall(tok)
+
+	case tokOp:
+		if tok.text == "(" {
+			if node, err = p.parseOr(); err != nil {
+				return
+			}
+			if err = p.expectOp(")"); err != nil {
+				return
+			}
+			return
+		}
+	}
+	return nil, p.errorf(tok, "unexpected '%s'", tok.text)
+}
+
+func (p *exprParser) parseCall(name exprToken) (node exprNode, err error) {
+	fct, found := exprFuncs[strings.ToLower(name.text)]
+	if !found {
+		return nil, p.errorf(name, "unknown function '%s'", name.text)
+	}
+	if err = p.expectOp("("); err != nil {
+		return
+	}
+	var args []exprNode
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err = p.expectOp(","); err != nil {
+				return
+			}
+		}
+		var arg exprNode
+		if arg, err = p.parseOr(); err != nil {
+			return
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	if len(args) != len(fct.args) {
+		return nil, p.errorf(name, "%s() expects %d argument(s), got %d", name.text, len(fct.args), len(args))
+	}
+	exprUnifyArgs(fct, args)
+	for i, arg := range args {
+		if fct.args[i] != exprNone && arg.typ() != fct.args[i] {
+			return nil, p.errorf(name, "%s() argument %d must be %s, got %s", name.text, i+1, fct.args[i], arg.typ())
+		}
+	}
+	res := fct.res
+	if fct.check != nil {
+		if res, err = fct.check(p, args); err != nil {
+			return nil, p.errorf(name, "%s() %s", name.text, err)
+		}
+	}
+	return &exprCall{name.text, fct, args, res}, nil
+}
+
+// exprAs : node checked at eval time to be of type t if it is a json sub-field (exprAny)
+func exprAs(node exprNode, t exprType) exprNode {
+	if node.typ() == exprAny && t != exprAny && t != exprNone {
+		return &exprAssert{node, t}
+	}
+	return node
+}
+
+// exprUnify : give a json sub-field operand the type of the other operand, t if both are json sub-fields
+func exprUnify(left, right exprNode, t exprType) (exprNode, exprNode) {
+	if left.typ() == exprAny && right.typ() != exprAny {
+		t = right.typ()
+	} else if right.typ() == exprAny && left.typ() != exprAny {
+		t = left.typ()
+	}
+	return exprAs(left, t), exprAs(right, t)
+}
+
+// exprUnifyArgs : json sub-field arguments get the declared argument type
+// For several arguments of any type (i.e. between), they get the type of the other arguments (number by default)
+func exprUnifyArgs(fct exprFunc, args []exprNode) {
+	anyArgs := []int{}
+	t := exprNumber
+	for i, arg := range args {
+		if fct.args[i] != exprNone {
+			args[i] = exprAs(arg, fct.args[i])
+			continue
+		}
+		anyArgs = append(anyArgs, i)
+		if arg.typ() != exprAny {
+			t = arg.typ()
+		}
+	}
+	if len(anyArgs) > 1 {
+		for _, i := range anyArgs {
+			args[i] = exprAs(args[i], t)
+		}
+	}
+}
+
+// -----------------------------------------------
+// Functions
+// -----------------------------------------------
+
+type exprFunc struct {
+	args  []exprType // exprNone : any type
+	res   exprType
+	check func(p *exprParser, args []exprNode) (exprType, error) // optional extra check, return result type
+	call  func(env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+// sameTypeArgs : check all args have the same type
+func sameTypeArgs(args []exprNode) error {
+	for _, arg := range args[1:] {
+		if arg.typ() != args[0].typ() {
+			return errors.New(fmt.Sprintf("arguments must have the same type (%s, %s)", args[0].typ(), arg.typ()))
+		}
+	}
+	return nil
+}
+
+// checkSensorArg : check first arg is a known sensor name, result type is the sensor data type
+func checkSensorArg(p *exprParser, args []exprNode) (exprType, error) {
+	name, ok := args[0].(*exprConst)
+	if !ok {
+		return exprNone, errors.New("argument must be a sensor name (string literal)")
+	}
+	sensor, found := getSensorByName(name.val.(string))
+	if !found {
+		return exprNone, errors.New(fmt.Sprintf("unknown sensor '%s'", name.val))
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return exprNone, err
+	}
+	p.sensorRefs = append(p.sensorRefs, sensor.getId())
+	return exprTypeOf(TDataType(dataType)), nil
+}
+
+// exprFuncs : functions by lower case name, function names are case insensitive
+var exprFuncs map[string]exprFunc
+
+func init() {
+	exprFuncs = map[string]exprFunc{
+		"now": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Unix()), nil
+		}},
+		"hour": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Hour()), nil
+		}},
+		"minute": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Minute()), nil
+		}},
+		"weekday": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Weekday()), nil // 0 = Sunday
+		}},
+		"day": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Day()), nil
+		}},
+		"month": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(env.now.Month()), nil
+		}},
+		"abs": {[]exprType{exprNumber}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return math.Abs(args[0].(float64)), nil
+		}},
+		"round": {[]exprType{exprNumber}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return math.Round(args[0].(float64)), nil
+		}},
+		"min": {[]exprType{exprNumber, exprNumber}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return math.Min(args[0].(float64), args[1].(float64)), nil
+		}},
+		"max": {[]exprType{exprNumber, exprNumber}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return math.Max(args[0].(float64), args[1].(float64)), nil
+		}},
+		"contains": {[]exprType{exprString, exprString}, exprBool, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return strings.Contains(args[0].(string), args[1].(string)), nil
+		}},
+		"lower": {[]exprType{exprString}, exprString, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return strings.ToLower(args[0].(string)), nil
+		}},
+		"len": {[]exprType{exprString}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return float64(len(args[0].(string))), nil
+		}},
+		"number": {[]exprType{exprString}, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return strconv.ParseFloat(strings.TrimSpace(args[0].(string)), 64)
+		}},
+		"string": {[]exprType{exprNone}, exprString, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			return exprFormat(args[0]), nil
+		}},
+		"json": {[]exprType{exprString, exprString}, exprString, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			path, err := parseJsonPath(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+			return jsonPathValue(args[0].(string), path)
+		}},
+		"between": {[]exprType{exprNone, exprNone, exprNone}, exprBool,
+			func(p *exprParser, args []exprNode) (exprType, error) {
+				if args[0].typ() == exprBool {
+					return exprNone, errors.New("arguments must be number or string")
+				}
+				return exprBool, sameTypeArgs(args)
+			},
+			func(env *exprEnv, args []interface{}) (interface{}, error) {
+				if v, ok := args[0].(float64); ok {
+					return v >= args[1].(float64) && v <= args[2].(float64), nil
+				}
+				v := args[0].(string)
+				return v >= args[1].(string) && v <= args[2].(string), nil
+			}},
+		"sensor": {[]exprType{exprString}, exprNone, checkSensorArg,
+			func(env *exprEnv, args []interface{}) (interface{}, error) {
+				if env.replay {
+					return getSensorExprValueAt(args[0].(string), env.now)
+				}
+				return getSensorExprValue(args[0].(string))
+			}},
+		"sensorat": {[]exprType{exprString, exprNumber}, exprNone, checkSensorArg,
+			func(env *exprEnv, args []interface{}) (interface{}, error) {
+				return getSensorExprValueAt(args[0].(string), time.Unix(int64(args[1].(float64)), 0))
+			}},
+		"today": {nil, exprNumber, nil, func(env *exprEnv, args []interface{}) (interface{}, error) {
+			y, m, d := env.now.Date()
+			return float64(time.Date(y, m, d, 0, 0, 0, 0, env.now.Location()).Unix()), nil
+		}},
+	}
+}
+
+// -----------------------------------------------
+// Nodes
+// -----------------------------------------------
+
+type exprNode interface {
+	typ() exprType
+	eval(env *exprEnv) (interface{}, error)
+}
+
+type exprConst struct {
+	val interface{}
+}
+
+func (n *exprConst) typ() exprType {
+	switch n.val.(type) {
+	case bool:
+		return exprBool
+	case float64:
+		return exprNumber
+	}
+	return exprString
+}
+
+func (n *exprConst) eval(env *exprEnv) (interface{}, error) {
+	return n.val, nil
+}
+
+type exprVar struct {
+	name string
+	t    exprType
+	path []interface{} // path in json value if any
+}
+
+func (n *exprVar) typ() exprType {
+	return n.t
+}
+
+func (n *exprVar) eval(env *exprEnv) (interface{}, error) {
+	val, found := env.vars[n.name]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("no value for variable '@%s@'", n.name))
+	}
+	if n.path != nil {
+		doc, ok := val.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("variable '@%s@' is not json", n.name))
+		}
+		subVal, err := jsonPathRaw(doc, n.path)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("variable '@%s@' : %s", n.name, err))
+		}
+		if n.t == exprAny {
+			return subVal, nil
+		}
+		val = subVal
+	}
+	switch val.(type) {
+	case bool:
+		if n.t == exprBool {
+			return val, nil
+		}
+	case float64:
+		if n.t == exprNumber {
+			return val, nil
+		}
+	case string:
+		if n.t == exprString {
+			return val, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("bad value type for variable '@%s@' (%v is not %s)", n.name, val, n.t))
+}
+
+// exprAssert : check at eval time the type of a json sub-field value
+type exprAssert struct {
+	x exprNode
+	t exprType
+}
+
+func (n *exprAssert) typ() exprType {
+	return n.t
+}
+
+func (n *exprAssert) eval(env *exprEnv) (interface{}, error) {
+	val, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case bool:
+		if n.t == exprBool {
+			return v, nil
+		}
+	case float64:
+		if n.t == exprNumber {
+			return v, nil
+		}
+	case string:
+		if n.t == exprString {
+			return v, nil
+		}
+		if n.t == exprNumber {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("bad json value type (%v is not %s)", val, n.t))
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (n *exprUnary) typ() exprType {
+	return n.x.typ()
+}
+
+func (n *exprUnary) eval(env *exprEnv) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !x.(bool), nil
+	}
+	return -x.(float64), nil
+}
+
+type exprLogical struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *exprLogical) typ() exprType {
+	return exprBool
+}
+
+func (n *exprLogical) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !left.(bool) {
+		return false, nil
+	}
+	if n.op == "||" && left.(bool) {
+		return true, nil
+	}
+	return n.right.eval(env)
+}
+
+type exprCompare struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *exprCompare) typ() exprType {
+	return exprBool
+}
+
+func (n *exprCompare) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r := right.(float64)
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	case string:
+		cmp = strings.Compare(l, right.(string))
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+type exprArith struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *exprArith) typ() exprType {
+	return n.left.typ()
+}
+
+func (n *exprArith) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := left.(string); ok {
+		return s + right.(string), nil
+	}
+	l, r := left.(float64), right.(float64)
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return l / r, nil
+	}
+	if r == 0 {
+		return nil, errors.New("modulo by zero")
+	}
+	return math.Mod(l, r), nil
+}
+
+type exprCall struct {
+	name string
+	fct  exprFunc
+	args []exprNode
+	res  exprType
+}
+
+func (n *exprCall) typ() exprType {
+	return n.res
+}
+
+func (n *exprCall) eval(env *exprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	res, err := n.fct.call(env, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s() : %s", n.name, err))
+	}
+	return res, nil
+}
@@ -0,0 +1,285 @@
+// expr_test.go
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exprTestVars : variables available in tests, as for a numeric sensor with a json sensor value
+var exprTestVars = map[string]exprType{
+	"lastVal":    exprNumber,
+	"prevVal":    exprNumber,
+	"sensorName": exprString,
+	"doc":        exprString,
+	"doc.*":      exprAny,
+}
+
+var exprTestEnv = exprEnv{
+	now: time.Date(2026, time.March, 14, 15, 9, 26, 0, time.Local),
+	vars: map[string]interface{}{
+		"lastVal":    21.5,
+		"prevVal":    19.0,
+		"sensorName": "Température",
+		"doc":        `{"temp":22.5,"probes":[{"hum":40},{"hum":55}],"status":"ok","on":true,"level":"12"}`,
+	},
+}
+
+func TestExprEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		// literals
+		{`12`, 12.0},
+		{`.5`, 0.5},
+		{`"a\"b"`, `a"b`},
+		{`'tab\there'`, "tab\there"},
+		{`TRUE`, true},
+		// precedence
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`10 - 4 - 3`, 3.0},
+		{`12 / 3 / 2`, 2.0},
+		{`7 % 4 * 2`, 6.0},
+		{`-2 * 3`, -6.0},
+		{`1 + 2 == 3`, true},
+		{`(1 < 2) == true`, true},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!true || true`, true},
+		{`not false and 1 > 2 or 2 > 1`, true},
+		// variables and comparisons
+		{`@lastVal@ > @prevVal@`, true},
+		{`@lastVal@ - @prevVal@ >= 2.5`, true},
+		{`@sensorName@ == "Température"`, true},
+		{`"abc" < "abd"`, true},
+		{`"a" + "b" == "ab"`, true},
+		// json sub-fields
+		{`@doc.temp@`, 22.5},
+		{`@doc.probes[1].hum@ - @doc.probes[0].hum@`, 15.0},
+		{`@doc.temp@ > 20 && @doc.probes[0].hum@ < @doc.probes[1].hum@`, true},
+		{`@doc.status@ == "ok"`, true},
+		{`"status " + @doc.status@`, "status ok"},
+		{`@doc.on@`, true},
+		{`!@doc.on@ || @doc.on@ == true`, true},
+		{`@doc.level@ * 2`, 24.0},
+		{`@doc.status@ == @doc.status@ && @doc.status@ != @doc.temp@`, true},
+		{`between(@doc.temp@, 20, 25)`, true},
+		{`contains(@doc.status@, "o")`, true},
+		{`string(@doc.on@)`, "1"},
+		// functions
+		{`hour() * 60 + minute()`, 909.0},
+		{`weekday() == 6 && day() == 14 && month() == 3`, true},
+		{`round(2.5) + abs(-1)`, 4.0},
+		{`round(-2.5) + round(-0.4)`, -3.0},
+		{`min(3, max(1, 2))`, 2.0},
+		{`between(@lastVal@, 20, 22)`, true},
+		{`between("b", "a", "c")`, true},
+		{`contains(lower(@sensorName@), "temp")`, true},
+		{`len("été")`, 5.0},
+		{`number(" 4.5 ") * 2`, 9.0},
+		{`string(1 == 1) + string(2.5)`, "12.5"},
+		{`json(@doc@, "probes[0].hum")`, "40"},
+		{`today() == now() - (15 * 3600 + 9 * 60 + 26)`, true},
+	}
+	for _, tt := range tests {
+		prog, err := exprCompile(tt.src, exprTestVars)
+		if err != nil {
+			t.Errorf("%s : compile error %s", tt.src, err)
+			continue
+		}
+		got, err := prog.Eval(exprTestEnv)
+		if err != nil {
+			t.Errorf("%s : eval error %s", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v (%T), want %v (%T)", tt.src, got, got, tt.want, tt.want)
+		}
+	}
+}
+
+func TestExprCompileError(t *testing.T) {
+	tests := []struct {
+		src string
+		err string // expected error part
+	}{
+		// scanner
+		{`"abc`, "col 1 : unterminated string"},
+		{`@lastVal > 1`, "missing closing '@'"},
+		{`@@ > 1`, "empty variable name"},
+		{`@lastVal@ = 1`, "col 11 : unexpected '=' (use '==' for comparison)"},
+		{`1 # 2`, "unexpected character '#'"},
+		{`2 × 3`, "unexpected character '×'"},
+		{`été(1)`, "unknown function 'été'"},
+		{"1 + \xff", "invalid utf-8 character"},
+		// parser
+		{`1 +`, "unexpected 'end of expression'"},
+		{`(1 + 2`, "expecting ')'"},
+		{`1 2`, "unexpected '2'"},
+		{`1 < 2 < 3`, "unexpected '<'"},
+		{`@unknown@`, "unknown variable '@unknown@'"},
+		{`@doc.a[x]@`, "bad index in json path"},
+		{`@lastVal.temp@`, "unknown variable"},
+		{`foo()`, "unknown function 'foo'"},
+		// type errors
+		{`1 + "a"`, "'+' not allowed between number and string"},
+		{`"a" - "b"`, "'-' not allowed between string and string"},
+		{`1 && true`, "'&&' needs bool operands"},
+		{`!1`, "'!' needs a bool operand"},
+		{`-"a"`, "'-' needs a number operand"},
+		{`@lastVal@ == "21"`, "can't compare number with string"},
+		{`true < false`, "'<' not allowed on bool"},
+		{`abs("a")`, "abs() argument 1 must be number, got string"},
+		{`min(1)`, "min() expects 2 argument(s), got 1"},
+		{`between(1, "a", 2)`, "arguments must have the same type"},
+		{`between(true, false, true)`, "arguments must be number or string"},
+		{`sensor(@sensorName@)`, "argument must be a sensor name"},
+	}
+	for _, tt := range tests {
+		_, err := exprCompile(tt.src, exprTestVars)
+		if err == nil {
+			t.Errorf("%s : no error, want '%s'", tt.src, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s : error '%s', want '%s'", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestExprEvalError(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`1 / (@lastVal@ - 21.5)`, "division by zero"},
+		{`5 % 0`, "modulo by zero"},
+		{`@doc.missing@ > 1`, "'missing' not found"},
+		{`@doc.probes[2].hum@ > 1`, "[2] : not found"},
+		{`@doc.probes@ > 1`, "not a single value"},
+		{`@doc.status@ > 1`, "bad json value type (ok is not number)"},
+		{`@doc.temp@ == "ok"`, "bad json value type (22.5 is not string)"},
+		{`@doc.status@ && true`, "bad json value type (ok is not bool)"},
+		{`-@doc.on@ < 0`, "bad json value type (true is not number)"},
+		{`number("abc") > 1`, "number() :"},
+	}
+	for _, tt := range tests {
+		prog, err := exprCompile(tt.src, exprTestVars)
+		if err != nil {
+			t.Errorf("%s : compile error %s", tt.src, err)
+			continue
+		}
+		_, err = prog.Eval(exprTestEnv)
+		if err == nil {
+			t.Errorf("%s : no error, want '%s'", tt.src, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s : error '%s', want '%s'", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestExprEvalBool(t *testing.T) {
+	prog, err := exprCompile(`@lastVal@ + 1`, exprTestVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = prog.EvalBool(exprTestEnv); err == nil || !strings.Contains(err.Error(), "is not a bool expression") {
+		t.Errorf("EvalBool on a number expression : %v", err)
+	}
+	// shortcut evaluation : right operand is not evaluated
+	prog, err = exprCompile(`false && 1 / 0 > 1`, exprTestVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := prog.EvalBool(exprTestEnv); err != nil || res {
+		t.Errorf("false && ... = %v, %v", res, err)
+	}
+}
+
+// exprTestSensor : create a DB from setup/init.sql and register its sensor named name
+func exprTestSensor(t *testing.T, name string) HomeObject {
+	dir, err := ioutil.TempDir("", "expr_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	initSql, err := ioutil.ReadFile(filepath.Join("setup", "init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "init.sql"), initSql, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = initDBFile(filepath.Join(dir, "expr_test.db")); err != nil {
+		t.Fatal(err)
+	}
+	sensors, err := getHomeObjects(nil, ItemSensor, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sensor := range sensors {
+		if sensor.getOptStrVal("Name", "") == name {
+			sensorRegister(sensor)
+			return sensor
+		}
+	}
+	t.Fatalf("no sensor '%s' in init.sql", name)
+	return HomeObject{}
+}
+
+func TestExprSensorAt(t *testing.T) {
+	sensor := exprTestSensor(t, "Alarm")
+	defer os.RemoveAll(filepath.Dir(dbFileName))
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for ts, val := range map[int64]string{1000: "3", 2000: "7"} {
+		if _, err = db.Exec("insert into HistoSensor values (?, ?, ?)", ts, sensor.getId(), val); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`sensorAt("Alarm", 1500)`, 3.0},
+		{`SensorAt("Alarm", 2000) - sensorAt("Alarm", 1000)`, 4.0},
+		{`sensorAt("Alarm", now()) == 7`, true},
+	}
+	for _, tt := range tests {
+		prog, err := exprCompile(tt.src, nil)
+		if err != nil {
+			t.Errorf("%s : compile error %s", tt.src, err)
+			continue
+		}
+		got, err := prog.Eval(exprEnv{now: time.Unix(3000, 0)})
+		if err != nil {
+			t.Errorf("%s : eval error %s", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v (%T), want %v (%T)", tt.src, got, got, tt.want, tt.want)
+		}
+	}
+
+	prog, err := exprCompile(`sensorAt("Alarm", 500) > 1`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = prog.Eval(exprEnv{now: time.Unix(3000, 0)}); err == nil || !strings.Contains(err.Error(), "no value for sensor 'Alarm'") {
+		t.Errorf("sensorAt before first value : %v", err)
+	}
+	if _, err = exprCompile(`sensorAt("Unknown", 0) > 1`, nil); err == nil || !strings.Contains(err.Error(), "unknown sensor 'Unknown'") {
+		t.Errorf("sensorAt unknown sensor : %v", err)
+	}
+}
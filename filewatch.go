@@ -0,0 +1,382 @@
+// filewatch.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+)
+
+// -----------------------------------------------
+// File watch sensors
+//
+// A file watch sensor is an internal sensor using the 'FileWatch' function, its ReadParam is a json FileWatchParam, i.e. :
+//   {"path":"/var/log/auth.log", "match":"Failed password for (invalid user )?(?P<user>\\S+)"}
+// The file is followed (like tail -F : new lines only, rotation and truncation handled) instead of
+// using Interval / Schedule. Changes are notified by inotify on the file directory (so the file may be created
+// or rotated), checked again every fileWatchCheck in case an event is missed, or every fileWatchPoll if inotify
+// is not available. Each line matching the regexp is a new sensor value :
+// - no capture group      : whole match
+// - one capture group     : the group
+// - several groups        : json object of named groups if any (for a JSON sensor), else groups separated by a space
+// Value is then transformed and handled as any other sensor value (record, sensorAct), a transform error is a
+// sensor read failure.
+// -----------------------------------------------
+
+const FileWatchFunc = "FileWatch"
+
+// fileWatchPoll : delay between checks for new lines or file rotation without inotify
+const fileWatchPoll = 500 * time.Millisecond
+
+// fileWatchCheck : delay between checks for new lines or file rotation without inotify event
+const fileWatchCheck = 10 * time.Second
+
+// fileWatchTail : size read at end of file to find last matching line (FileWatch called as a regular sensor function)
+const fileWatchTail = 64 * 1024
+
+type FileWatchParam struct {
+	Path  string // file to follow
+	Match string // regexp a line must match
+}
+
+// fileWatcher : follow a file for a sensor, stopped like sensor tickers
+type fileWatcher struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	notify   *fileNotify // nil if inotify is not available
+	polling  bool        // inotify failed while following
+}
+
+// fileNotify : inotify events on the directory of a file, C receives a value when the file changed
+type fileNotify struct {
+	file *os.File
+	C    chan struct{}
+}
+
+func init() {
+	RegisterInternalFunc(SensorFunc, FileWatchFunc, FileWatch)
+}
+
+// isFileWatchSensor : check if sensor values come from a followed file
+func isFileWatchSensor(sensor HomeObject) bool {
+	return sensor.getOptIntVal("IsInternal", 0) != 0 && sensor.getOptStrVal("ReadCmd", "") == FileWatchFunc
+}
+
+// getFileWatchParam : unmarshal and check file watch parameters
+func getFileWatchParam(param1 string) (param FileWatchParam, re *regexp.Regexp, err error) {
+	if err = json.Unmarshal([]byte(param1), &param); err != nil {
+		err = errors.New(fmt.Sprintf("FileWatch : fail to unmarshal param '%s' : %s", param1, err))
+		return
+	}
+	if len(param.Path) <= 0 {
+		err = errors.New("FileWatch : missing path")
+		return
+	}
+	if len(param.Match) <= 0 {
+		err = errors.New("FileWatch : missing match")
+		return
+	}
+	if re, err = regexp.Compile(param.Match); err != nil {
+		err = errors.New(fmt.Sprintf("FileWatch : bad match '%s' : %s", param.Match, err))
+	}
+	return
+}
+
+// checkSensorFileWatch : check file watch sensor parameters
+func checkSensorFileWatch(sensor HomeObject) (err error) {
+	if !isFileWatchSensor(sensor) {
+		return
+	}
+	_, _, err = getFileWatchParam(sensor.getOptStrVal("ReadParam", ""))
+	return
+}
+
+// fileWatchValue : sensor value for a line, false if line does not match
+func fileWatchValue(re *regexp.Regexp, line string) (string, bool) {
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	switch len(match) {
+	case 1:
+		return match[0], true
+	case 2:
+		return match[1], true
+	}
+
+	named := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if i > 0 && len(name) > 0 {
+			named[name] = match[i]
+		}
+	}
+	if len(named) > 0 {
+		if b, err := json.Marshal(named); err == nil {
+			return string(b), true
+		}
+	}
+	return strings.Join(match[1:], " "), true
+}
+
+// FileWatch : internal sensor function, value for the last matching line at end of file (used when no value yet)
+func FileWatch(param1 string, param2 string) (string, error) {
+	param, re, err := getFileWatchParam(param1)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(param.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > fileWatchTail {
+		f.Seek(-fileWatchTail, io.SeekEnd)
+	}
+
+	var value string
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := fileWatchValue(re, scanner.Text()); ok {
+			value, found = v, true
+		}
+	}
+	if !found {
+		return "", errors.New(fmt.Sprintf("FileWatch : no line matching '%s' in %s", param.Match, param.Path))
+	}
+	return value, nil
+}
+
+// -----------------------------------------------
+
+// newFileWatcher : start following sensor file
+func newFileWatcher(sensor HomeObject) (watcher *fileWatcher, err error) {
+	param, re, err := getFileWatchParam(sensor.getOptStrVal("ReadParam", ""))
+	if err != nil {
+		return
+	}
+	watcher = &fileWatcher{stop: make(chan struct{})}
+	if watcher.notify, err = newFileNotify(param.Path); err != nil {
+		glog.Errorf("FileWatch %d : no inotify for %s, polling (%s)", sensor.getId(), param.Path, err)
+		err = nil
+	}
+	go watcher.follow(sensor, param.Path, re)
+	return
+}
+
+// Stop : stop following file
+func (watcher *fileWatcher) Stop() {
+	watcher.stopOnce.Do(func() {
+		close(watcher.stop)
+		if watcher.notify != nil {
+			watcher.notify.Close()
+		}
+	})
+}
+
+// wait : wait for a file change (or next check), false if watcher is stopped
+func (watcher *fileWatcher) wait() bool {
+	if watcher.notify == nil || watcher.polling {
+		select {
+		case <-watcher.stop:
+			return false
+		case <-time.After(fileWatchPoll):
+			return true
+		}
+	}
+	timer := time.NewTimer(fileWatchCheck)
+	defer timer.Stop()
+	select {
+	case <-watcher.stop:
+		return false
+	case _, ok := <-watcher.notify.C:
+		if !ok {
+			// inotify read failed : polling
+			select {
+			case <-watcher.stop:
+				return false
+			default:
+			}
+			glog.Errorf("FileWatch : inotify stopped, polling")
+			watcher.polling = true
+		}
+		return true
+	case <-timer.C:
+		return true
+	}
+}
+
+// -----------------------------------------------
+
+// newFileNotify : watch with inotify the directory of path for changes on path
+func newFileNotify(path string) (notify *fileNotify, err error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return
+	}
+	mask := uint32(unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO)
+	if _, err = unix.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		unix.Close(fd)
+		return
+	}
+	// non blocking fd : Read is woken up by Close
+	notify = &fileNotify{file: os.NewFile(uintptr(fd), "inotify"), C: make(chan struct{}, 1)}
+	go notify.read(filepath.Base(path))
+	return
+}
+
+// read : signal events on file name until closed, C is then closed
+func (notify *fileNotify) read(name string) {
+	defer close(notify.C)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := notify.file.Read(buf)
+		if err != nil {
+			return
+		}
+		changed := false
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			end := offset + unix.SizeofInotifyEvent + int(event.Len)
+			if end > n {
+				break
+			}
+			eventName := strings.TrimRight(string(buf[offset+unix.SizeofInotifyEvent:end]), "\x00")
+			if eventName == name || event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				changed = true
+			}
+			offset = end
+		}
+		if changed {
+			select {
+			case notify.C <- struct{}{}:
+			default: // a change is already waiting
+			}
+		}
+	}
+}
+
+// Close : stop watching
+func (notify *fileNotify) Close() error {
+	return notify.file.Close()
+}
+
+// follow : read new lines until watcher is stopped, reopen file when rotated or truncated
+func (watcher *fileWatcher) follow(sensor HomeObject, path string, re *regexp.Regexp) {
+	sensorId := sensor.getId()
+	var f *os.File
+	var reader *bufio.Reader
+	var offset int64
+	var partial string
+
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	// open : (re)open file, start at end on first open (only new lines), at start after a rotation
+	open := func(atEnd bool) bool {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			f = nil
+			return false
+		}
+		offset = 0
+		if atEnd {
+			if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+				glog.Errorf("FileWatch %d : %s", sensorId, err)
+			}
+		}
+		reader = bufio.NewReader(f)
+		partial = ""
+		return true
+	}
+
+	if !open(true) {
+		glog.Errorf("FileWatch %d : can't open %s, waiting for it", sensorId, path)
+	}
+	if glog.V(2) {
+		glog.Infof("FileWatch %d : following %s", sensorId, path)
+	}
+
+	// readLines : handle all available complete lines
+	readLines := func() {
+		for f != nil {
+			line, err := reader.ReadString('\n')
+			offset += int64(len(line))
+			if err != nil {
+				partial += line // incomplete line, wait for the end of it
+				return
+			}
+			line = strings.TrimRight(partial+line, "\r\n")
+			partial = ""
+			value, ok := fileWatchValue(re, line)
+			if !ok {
+				continue
+			}
+			if value, err = transformSensorValue(sensor, value); err != nil {
+				glog.Errorf("FileWatch %d : %s", sensorId, err)
+				sensorHealthFailed(sensor, err)
+				continue
+			}
+			if glog.V(2) {
+				glog.Infof("FileWatch %d : %s", sensorId, value)
+			}
+			handleSensorValue(time.Now(), sensor, value)
+		}
+	}
+
+	for {
+		readLines()
+
+		if !watcher.wait() {
+			return
+		}
+
+		// File missing at start or removed
+		if f == nil {
+			open(false)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // rotated but new file not created yet
+		}
+		cur, err := f.Stat()
+		if err != nil {
+			glog.Errorf("FileWatch %d : %s", sensorId, err)
+			continue
+		}
+		if !os.SameFile(info, cur) {
+			// Rotated : read lines written to the old file before rotation, then follow the new file from its beginning
+			if glog.V(1) {
+				glog.Infof("FileWatch %d : %s rotated", sensorId, path)
+			}
+			readLines()
+			f.Close()
+			open(false)
+		} else if cur.Size() < offset {
+			// Truncated : restart from the beginning
+			if glog.V(1) {
+				glog.Infof("FileWatch %d : %s truncated", sensorId, path)
+			}
+			f.Close()
+			open(false)
+		}
+	}
+}
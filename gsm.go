@@ -17,6 +17,7 @@ import (
 func init() {
 	RegisterInternalFunc(SensorFunc, "GsmIsUp", GsmIsUp)
 	RegisterInternalFunc(ActorFunc, "GsmRestart", GsmRestart)
+	RegisterInternalFunc(ActorFunc, "GsmSMS", GsmSMS)
 }
 
 const (
@@ -87,6 +88,8 @@ func gsmSetup(db *sql.DB) (err error) {
 
 //
 func gsmCleanup() {
+	// Wait for a running AT command, SMS sender reads gsmPort under lock
+	gsmPortLock.Lock()
 	if gsmPort != nil {
 		if err := gsmPort.Close(); err != nil {
 			glog.Errorf("gsmCleanup error closing device : %s", err)
@@ -94,6 +97,7 @@ func gsmCleanup() {
 	}
 	gsmDevice = ""
 	gsmPort = nil
+	gsmPortLock.Unlock()
 	if glog.V(1) {
 		glog.Infof("gsmCleanup Done")
 	}
@@ -381,7 +385,8 @@ func SerialATSMS(serialPort string, phoneNum string, message string) (result str
 
 	// \x1a == (char)26 == ^Z
 	if err = gsmSendCmdAT(message+"\x1a\r", AT_OK, time.Second*10); err != nil {
-		result, err = GsmRestart("", "") // Try restart to prepare next try
+		// Device restart is left to the caller (see gsmSMSQueue)
+		result = "Fail"
 		return
 	}
 
@@ -393,3 +398,111 @@ func SerialATSMS(serialPort string, phoneNum string, message string) (result str
 
 	return
 }
+
+// -----------------------------------------------
+// GSM SMS actor
+//
+// GsmSMS sends SMS through a queue : one SMS at a time on the GSM device. An SMS failing on the device is sent
+// again after a device restart (GsmRestart), then through the HTTP gateway (SendSMS) if the device still fails
+// or is down (not configured or gsmSetup failed). An SMS not queued (queue full) is sent through the gateway. A queued SMS is sent even if the actor call timed out, so
+// actor 'Timeout' should allow for a restart (i.e. 2m).
+// -----------------------------------------------
+
+// gsmSMSQueueSize : max SMS waiting for the device
+const gsmSMSQueueSize = 20
+
+// gsmSMSRetries : nb device restart and retry before using the HTTP gateway
+const gsmSMSRetries = 1
+
+// gsmSMSReq : an SMS waiting in queue
+type gsmSMSReq struct {
+	device   string
+	gateway  string
+	phoneNum string
+	message  string
+	res      chan gsmSMSRes
+}
+
+type gsmSMSRes struct {
+	result string
+	err    error
+}
+
+var gsmSMSQueueOnce sync.Once
+var gsmSMSQueue chan gsmSMSReq
+
+// GsmSMS : send a SMS using the GSM device, or the HTTP gateway if the device is down
+// param1 : "<device> [<SMS Gateway serveur[:port]>]" i.e. "/dev/ttyAMA0 192.168.43.1:1116", no fallback without gateway
+// param2 : "<phoneNum> <message>" with phoneNum := "[0-9]+"
+func GsmSMS(param1 string, param2 string) (result string, err error) {
+	devTab := strings.Fields(param1)
+	pTab := strings.Split(param2, " ")
+	if len(devTab) <= 0 || len(devTab) > 2 || len(pTab) <= 1 {
+		err = errors.New("GsmSMS bad parameters ('" + param1 + "', '" + param2 + "'), expecting '<device> [<gateway>]' and '<phoneNum> <message>'")
+		glog.Errorf(err.Error())
+		result = "bad parameter"
+		return
+	}
+	req := gsmSMSReq{device: devTab[0], phoneNum: pTab[0], message: strings.Join(pTab[1:], " "), res: make(chan gsmSMSRes, 1)}
+	if len(devTab) > 1 {
+		req.gateway = devTab[1]
+	}
+
+	gsmSMSQueueOnce.Do(func() {
+		gsmSMSQueue = make(chan gsmSMSReq, gsmSMSQueueSize)
+		go gsmSMSSender()
+	})
+	select {
+	case gsmSMSQueue <- req:
+	default:
+		return gsmGatewaySMS(req, errors.New(fmt.Sprintf("GsmSMS queue full (%d SMS waiting)", gsmSMSQueueSize)))
+	}
+
+	res := <-req.res
+	return res.result, res.err
+}
+
+// gsmSMSSender : send queued SMS one at a time
+func gsmSMSSender() {
+	for req := range gsmSMSQueue {
+		result, err := gsmSendSMS(req)
+		req.res <- gsmSMSRes{result, err}
+	}
+}
+
+// gsmSendSMS : send a SMS using the GSM device (restarted on failure), then the HTTP gateway
+func gsmSendSMS(req gsmSMSReq) (result string, err error) {
+	gsmPortLock.Lock()
+	deviceUp := gsmPort != nil && gsmDevice == req.device
+	gsmPortLock.Unlock()
+
+	if !deviceUp {
+		err = errors.New(fmt.Sprintf("GsmSMS : GSM device '%s' is down", req.device))
+	} else {
+		for try := 0; ; try++ {
+			if result, err = SerialATSMS(req.device, req.phoneNum, req.message); err == nil {
+				return
+			}
+			if try >= gsmSMSRetries {
+				break
+			}
+			glog.Errorf("GsmSMS to %s failed (%s), restarting GSM device", req.phoneNum, err)
+			GsmRestart("", "")
+		}
+	}
+	return gsmGatewaySMS(req, err)
+}
+
+// gsmGatewaySMS : send a SMS using the HTTP gateway, failing with cause if there is no gateway
+func gsmGatewaySMS(req gsmSMSReq, cause error) (result string, err error) {
+	if len(req.gateway) <= 0 {
+		glog.Errorf("GsmSMS to %s failed, no HTTP gateway : %s", req.phoneNum, cause)
+		result, err = "Fail", cause
+		return
+	}
+	glog.Errorf("GsmSMS to %s using HTTP gateway %s : %s", req.phoneNum, req.gateway, cause)
+	if result, err = SendSMS(req.gateway, req.phoneNum+" "+req.message); err == nil && result == "Done" {
+		result = "Done (gateway)"
+	}
+	return
+}
@@ -0,0 +1,207 @@
+// health.go
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Sensor health
+//
+// For each sensor : last value time, consecutive read failures and last error.
+// A sensor with 'StaleAfter' = N (0 = never stale) becomes stale when no value was handled during the last
+// N periods (Interval or Schedule), i.e. N missed readings. The stale flag is cleared by the next value.
+// SensorAct with 'Event' = Stale / Recovered are triggered when their master sensor becomes stale / recovers,
+// using the last known value of the sensor (tag @lastError@ available in ActorParam).
+// -----------------------------------------------
+
+// TSensorEvent : event triggering a sensorAct (sensorAct 'Event' field)
+type TSensorEvent int
+
+const (
+	SensorEventValue     TSensorEvent = iota // new sensor value
+	SensorEventStale                         // sensor became stale
+	SensorEventRecovered                     // stale sensor got a new value
+)
+
+// healthCheckPeriod : delay between stale checks
+const healthCheckPeriod = 10 * time.Second
+
+// SensorHealth : health state of a sensor
+type SensorHealth struct {
+	LastSuccess int64  // unix time of last value, 0 if none since start
+	LastFailure int64  // unix time of last read failure, 0 if none since start
+	Failures    int    // nb of consecutive read failures
+	LastError   string // last read error
+	Stale       bool
+	StaleSince  int64 // unix time sensor became stale
+	since       time.Time
+}
+
+var sensorHealthsLock sync.Mutex
+var sensorHealths = map[int]*SensorHealth{}
+
+var healthTicker *time.Ticker
+var healthStop chan bool
+
+// -----------------------------------------------
+
+// healthSetup : start stale checks
+func healthSetup() {
+	healthTicker = time.NewTicker(healthCheckPeriod)
+	healthStop = make(chan bool)
+	go func(tickerC <-chan time.Time, stop chan bool) {
+		for {
+			select {
+			case t := <-tickerC:
+				checkSensorsHealth(t)
+			case <-stop:
+				return
+			}
+		}
+	}(healthTicker.C, healthStop)
+
+	if glog.V(1) {
+		glog.Info("healthSetup Done")
+	}
+}
+
+// healthCleanup : stop stale checks
+func healthCleanup() {
+	if healthTicker != nil {
+		healthTicker.Stop()
+		close(healthStop)
+		healthTicker = nil
+	}
+	if glog.V(1) {
+		glog.Info("healthCleanup Done")
+	}
+}
+
+// getHealth : sensor health entry (created if needed), sensorHealthsLock must be held
+func getHealth(sensorId int, now time.Time) *SensorHealth {
+	health, found := sensorHealths[sensorId]
+	if !found {
+		health = &SensorHealth{since: now}
+		sensorHealths[sensorId] = health
+	}
+	return health
+}
+
+// sensorHealthReset : sensor (re)started, restart counting missed periods from now
+func sensorHealthReset(sensorId int) {
+	sensorHealthsLock.Lock()
+	getHealth(sensorId, time.Now()).since = time.Now()
+	sensorHealthsLock.Unlock()
+}
+
+// sensorHealthOk : sensor value handled, trigger Recovered event if sensor was stale
+// LastSuccess is the time the value is handled, not the reading time (a pushed reading may be back-dated)
+func sensorHealthOk(sensor HomeObject) {
+	now := time.Now()
+	sensorHealthsLock.Lock()
+	health := getHealth(sensor.getId(), now)
+	health.LastSuccess = now.Unix()
+	health.Failures = 0
+	recovered := health.Stale
+	health.Stale = false
+	health.StaleSince = 0
+	sensorHealthsLock.Unlock()
+
+	if recovered {
+		glog.Infof("Sensor %d recovered", sensor.getId())
+		triggerSensorEventAct(sensor, SensorEventRecovered)
+	}
+}
+
+// sensorHealthFailed : sensor read failure
+func sensorHealthFailed(sensor HomeObject, err error) {
+	sensorHealthsLock.Lock()
+	health := getHealth(sensor.getId(), time.Now())
+	health.LastFailure = time.Now().Unix()
+	health.Failures++
+	health.LastError = err.Error()
+	sensorHealthsLock.Unlock()
+}
+
+// getSensorHealth : return a copy of sensor health
+func getSensorHealth(sensorId int) SensorHealth {
+	sensorHealthsLock.Lock()
+	defer sensorHealthsLock.Unlock()
+	health, found := sensorHealths[sensorId]
+	if !found {
+		return SensorHealth{}
+	}
+	return *health
+}
+
+// -----------------------------------------------
+
+// getSensorStaleDeadline : time after which sensor is stale if no value was handled since last
+// Return false if sensor can't be stale (StaleAfter not set, no Interval / Schedule)
+func getSensorStaleDeadline(sensor HomeObject, last time.Time) (deadline time.Time, ok bool) {
+	staleAfter := sensor.getOptIntVal("StaleAfter", 0)
+	if staleAfter <= 0 || isFileWatchSensor(sensor) {
+		return
+	}
+
+	schedule := strings.TrimSpace(sensor.getOptStrVal("Schedule", ""))
+	if len(schedule) > 0 {
+		sched, err := parseCronSchedule(schedule)
+		if err != nil {
+			return
+		}
+		deadline = last
+		for i := 0; i < staleAfter; i++ {
+			if deadline, err = sched.Next(deadline); err != nil {
+				return
+			}
+		}
+		return deadline, true
+	}
+
+	interval, err := time.ParseDuration(strings.TrimSpace(sensor.getOptStrVal("Interval", "")))
+	if err != nil || interval <= 0 {
+		return
+	}
+	return last.Add(time.Duration(staleAfter) * interval), true
+}
+
+// checkSensorsHealth : flag active sensors without value for too long as stale and trigger Stale event
+func checkSensorsHealth(now time.Time) {
+	sensorRegistryLock.Lock()
+	sensors := make([]HomeObject, 0, len(sensorRegistry))
+	for _, sensor := range sensorRegistry {
+		if sensor.getOptIntVal("IsActive", 0) != 0 {
+			sensors = append(sensors, sensor)
+		}
+	}
+	sensorRegistryLock.Unlock()
+
+	for _, sensor := range sensors {
+		sensorId := sensor.getId()
+
+		sensorHealthsLock.Lock()
+		health := getHealth(sensorId, now)
+		last := health.since
+		if lastSuccess := time.Unix(health.LastSuccess, 0); lastSuccess.After(last) {
+			last = lastSuccess
+		}
+		deadline, ok := getSensorStaleDeadline(sensor, last)
+		stale := ok && !health.Stale && now.After(deadline)
+		if stale {
+			health.Stale = true
+			health.StaleSince = now.Unix()
+		}
+		sensorHealthsLock.Unlock()
+
+		if stale {
+			glog.Infof("Sensor %d is stale (no value since %v)", sensorId, last)
+			triggerSensorEventAct(sensor, SensorEventStale)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// histo.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// History rollups and retention
+//
+// Numeric sensor values (bool, int, float) from HistoSensor are summarized in HistoRollup
+// (min / max / avg / count) for each resolution of histoRollupRes : 5m rollups are computed from raw values,
+// other resolutions from 5m rollups (so local days are made of whole buckets in any time zone). Buckets are computed once complete, 5m and 1h buckets are
+// aligned on UTC, daily buckets start at local midnight (23 or 25 hours on DST change days).
+// A value recorded late (SendSensorVal) in an already rolled up bucket is added to this bucket.
+//
+// Reading rollups (ReadHistoVal with a resolution) : a range not covered by the chosen rollups is read from
+// coarser rollups (finer ones purged by retention), then summarized from raw values (not rolled up yet).
+//
+// Retention (in days, 0 = keep forever) :
+// - raw values : sensor 'RetentionDays' field (last value of a sensor is always kept)
+// - rollups and HistoActor : goHome 'History' parameters (see histoRetentionParam)
+// -----------------------------------------------
+
+// histoRollupRes : rollup resolutions in seconds, from finest to coarsest
+var histoRollupRes = []int64{300, 3600, 86400}
+
+// histoDay : daily rollup resolution, buckets start at local midnight
+const histoDay = 86400
+
+// histoRetentionParam : goHome 'History' parameter name for each rollup resolution
+var histoRetentionParam = map[int64]string{300: "retention_5m", 3600: "retention_1h", 86400: "retention_1d"}
+
+const histoCreateRollup = "create table if not exists HistoRollup (idObject integer not null, resolution integer not null, ts datetime not null, minVal real, maxVal real, avgVal real, nbVal integer);"
+const histoCreateRollupPK = "create unique index if not exists HistoRollup_PK on HistoRollup (idObject, resolution, ts);"
+
+var histoTicker *cronTicker
+
+// histoRollupLock : rollup job and late values update rollups one at a time
+var histoRollupLock sync.Mutex
+
+// -----------------------------------------------
+
+// histoSetup : create rollup table if needed (DB created before rollups) and start rollup / purge job
+func histoSetup(db *sql.DB) (err error) {
+	for _, stmt := range []string{histoCreateRollup, histoCreateRollupPK} {
+		if _, err = db.Exec(stmt); err != nil {
+			glog.Errorf("histoSetup : %s : %s", stmt, err)
+			return
+		}
+	}
+
+	schedule, err := getGlobalParam(db, "History", "schedule")
+	if err != nil || len(schedule) <= 0 {
+		schedule = "*/5"
+	}
+	sched, err := parseCronSchedule(schedule)
+	if err != nil {
+		glog.Errorf("histoSetup : %s", err)
+		return
+	}
+
+	histoTicker = newCronTicker(sched)
+	go func(tickerC <-chan time.Time) {
+		for t := range tickerC {
+			histoJob(t)
+		}
+	}(histoTicker.C)
+
+	if glog.V(1) {
+		glog.Infof("histoSetup Done (%s)", schedule)
+	}
+	return nil
+}
+
+// histoCleanup : stop rollup / purge job
+func histoCleanup() {
+	if histoTicker != nil {
+		histoTicker.Stop()
+		histoTicker = nil
+	}
+	if glog.V(1) {
+		glog.Info("histoCleanup Done")
+	}
+}
+
+// histoJob : compute rollups then purge old values for all sensors
+func histoJob(now time.Time) {
+	db, err := openDB()
+	if err != nil {
+		glog.Errorf("histoJob : fail to open DB : %s", err)
+		return
+	}
+	defer db.Close()
+
+	sensors, err := getHomeObjects(db, ItemSensor, -1)
+	if err != nil {
+		return
+	}
+
+	for _, sensor := range sensors {
+		if isRollupDataType(sensor) {
+			histoRollupLock.Lock()
+			err = rollupSensor(db, sensor.getId(), now)
+			histoRollupLock.Unlock()
+			if err != nil {
+				continue
+			}
+		}
+		if days := sensor.getOptIntVal("RetentionDays", 0); days > 0 {
+			purgeHistoSensor(db, sensor.getId(), now.AddDate(0, 0, -days))
+		}
+	}
+
+	params, err := getGlobalParamList(db, "History")
+	if err != nil {
+		return
+	}
+	for _, res := range histoRollupRes {
+		if days := histoRetentionDays(params, histoRetentionParam[res]); days > 0 {
+			purgeHistoRollup(db, res, now.AddDate(0, 0, -days))
+		}
+	}
+	if days := histoRetentionDays(params, "retention_actor"); days > 0 {
+		purgeHistoActor(db, now.AddDate(0, 0, -days))
+	}
+}
+
+// histoRetentionDays : read a retention parameter (0 if missing or invalid)
+func histoRetentionDays(params map[string]string, name string) int {
+	val, found := params[name]
+	if !found || len(val) <= 0 {
+		return 0
+	}
+	days, err := strconv.Atoi(val)
+	if err != nil {
+		glog.Errorf("Bad History parameter %s (%s) : %s", name, val, err)
+		return 0
+	}
+	return days
+}
+
+// isRollupDataType : check if sensor values can be rolled up
+func isRollupDataType(sensor HomeObject) bool {
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return false
+	}
+	switch TDataType(dataType) {
+	case DBTypeBool, DBTypeInt, DBTypeFloat:
+		return true
+	}
+	return false
+}
+
+// histoRollupFor : best rollup resolution for a requested resolution (0 if raw values must be used)
+func histoRollupFor(resolution int64) (res int64) {
+	for _, r := range histoRollupRes {
+		if r <= resolution {
+			res = r
+		}
+	}
+	return
+}
+
+// histoBucketStart : start of the bucket of resolution res containing t
+func histoBucketStart(t time.Time, res int64) time.Time {
+	if res == histoDay {
+		y, m, d := t.In(time.Local).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	return time.Unix((t.Unix()/res)*res, 0)
+}
+
+// histoBucketNext : start of the bucket of resolution res following the bucket starting at bucket
+func histoBucketNext(bucket time.Time, res int64) time.Time {
+	if res == histoDay {
+		return histoBucketStart(bucket.In(time.Local).AddDate(0, 0, 1), res)
+	}
+	return bucket.Add(time.Duration(res) * time.Second)
+}
+
+// histoBucketExpr : SQL expression of the bucket (unix time) of column ts for resolution res
+func histoBucketExpr(res int64) string {
+	if res == histoDay {
+		return "cast(strftime('%s', ts, 'unixepoch', 'localtime', 'start of day', 'utc') as integer)"
+	}
+	return fmt.Sprintf("(ts / %d) * %d", res, res)
+}
+
+// -----------------------------------------------
+
+// getSensorRollups : values of a sensor between start and end summarized with rollups of resolution res.
+// Older values without res rollups (purged) are read from coarser rollups, or else summarized from raw values.
+// Newer values not rolled up yet are summarized from raw values.
+func getSensorRollups(db *sql.DB, sensorId int, res int64, start time.Time, end time.Time) (values []HistoRollup, err error) {
+	if end.Before(time.Date(2016, time.January, 1, 0, 0, 0, 0, time.Local)) {
+		end = time.Now()
+	}
+	return readSensorRollups(db, sensorId, res, res, start, end)
+}
+
+// readSensorRollups : getSensorRollups using rollups of resolution res, raw values summarized with rawRes
+func readSensorRollups(db *sql.DB, sensorId int, res int64, rawRes int64, start time.Time, end time.Time) (values []HistoRollup, err error) {
+	rVals, err := getHistoRollup(db, sensorId, res, start, end)
+	if err != nil {
+		return
+	}
+
+	// [start, first[ : older values without res rollups
+	first := end.Add(time.Second)
+	if len(rVals) > 0 {
+		first = rVals[0].Ts
+	}
+	if first.After(start) {
+		var head []HistoRollup
+		if coarser := histoCoarserRes(res); coarser > 0 {
+			cVals, err := readSensorRollups(db, sensorId, coarser, rawRes, start, first.Add(-time.Second))
+			if err != nil {
+				return nil, err
+			}
+			// coarser buckets overlapping res rollups are left out, raw values (if any) fill the gap
+			gap := start
+			for _, cVal := range cVals {
+				if next := histoBucketNext(cVal.Ts, cVal.Resolution); !next.After(first) {
+					head = append(head, cVal)
+					gap = next
+				}
+			}
+			if len(head) > 0 && gap.Before(first) {
+				rVals, err := summarizeHistoSensor(db, sensorId, rawRes, gap, first.Add(-time.Second))
+				if err != nil {
+					return nil, err
+				}
+				head = append(head, rVals...)
+			}
+		}
+		if len(head) <= 0 {
+			if head, err = summarizeHistoSensor(db, sensorId, rawRes, start, first.Add(-time.Second)); err != nil {
+				return
+			}
+		}
+		values = append(values, head...)
+	}
+	values = append(values, rVals...)
+
+	// [next, end] : newer values not rolled up yet
+	if len(rVals) > 0 {
+		if next := histoBucketNext(rVals[len(rVals)-1].Ts, res); !next.After(end) {
+			tail, err := summarizeHistoSensor(db, sensorId, rawRes, next, end)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, tail...)
+		}
+	}
+	return
+}
+
+// histoCoarserRes : next coarser rollup resolution (0 if none)
+func histoCoarserRes(res int64) int64 {
+	for i, r := range histoRollupRes {
+		if r == res && i+1 < len(histoRollupRes) {
+			return histoRollupRes[i+1]
+		}
+	}
+	return 0
+}
+
+// -----------------------------------------------
+
+// rollupSensor : compute missing complete buckets for each rollup resolution
+func rollupSensor(db *sql.DB, sensorId int, now time.Time) (err error) {
+	for i, res := range histoRollupRes {
+		var last sql.NullInt64
+		err = db.QueryRow("select cast(max(ts) as integer) from HistoRollup where idObject = ? and resolution = ?", sensorId, res).Scan(&last)
+		if err != nil {
+			glog.Errorf("rollupSensor %d (%d) : read last rollup fail : %s", sensorId, res, err)
+			return
+		}
+		start := int64(0)
+		if last.Valid {
+			start = histoBucketNext(time.Unix(last.Int64, 0), res).Unix()
+		}
+		end := histoBucketStart(now, res).Unix()
+		bucket := histoBucketExpr(res)
+
+		if i == 0 {
+			_, err = db.Exec(`insert or replace into HistoRollup
+				select idObject, ?, `+bucket+`, min(cast(Val as real)), max(cast(Val as real)), avg(cast(Val as real)), count(*)
+				from HistoSensor where idObject = ? and ts >= ? and ts < ? group by `+bucket,
+				res, sensorId, start, end)
+		} else {
+			_, err = db.Exec(`insert or replace into HistoRollup
+				select idObject, ?, `+bucket+`, min(minVal), max(maxVal), sum(avgVal * nbVal) / sum(nbVal), sum(nbVal)
+				from HistoRollup where idObject = ? and resolution = ? and ts >= ? and ts < ? group by `+bucket,
+				res, sensorId, histoRollupRes[0], start, end)
+		}
+		if err != nil {
+			glog.Errorf("rollupSensor %d (%d) : %s", sensorId, res, err)
+			return
+		}
+	}
+	return
+}
+
+// rollupLateValue : add a value recorded after its buckets were rolled up to these buckets
+// Buckets not rolled up yet are left to rollupSensor. Called with histoRollupLock held
+func rollupLateValue(db *sql.DB, sensor HomeObject, t time.Time, value string) {
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	for _, res := range histoRollupRes {
+		bucket := histoBucketStart(t, res).Unix()
+		_, err = db.Exec(`insert into HistoRollup
+			select ?, ?, ?, ?, ?, ?, 1 where ? <= (select max(ts) from HistoRollup where idObject = ? and resolution = ?)
+			on conflict(idObject, resolution, ts) do update set minVal = min(minVal, excluded.minVal), maxVal = max(maxVal, excluded.maxVal),
+			avgVal = (avgVal * nbVal + excluded.avgVal) / (nbVal + 1), nbVal = nbVal + 1;`,
+			sensor.getId(), res, bucket, val, val, val, bucket, sensor.getId(), res)
+		if err != nil {
+			glog.Errorf("rollupLateValue %d (%d) : %s", sensor.getId(), res, err)
+			return
+		}
+	}
+}
+
+// purgeHistoSensor : remove sensor values older than before, the last value is always kept
+func purgeHistoSensor(db *sql.DB, sensorId int, before time.Time) {
+	res, err := db.Exec("delete from HistoSensor where idObject = ? and ts < ? and ts < (select max(ts) from HistoSensor where idObject = ?)",
+		sensorId, before.Unix(), sensorId)
+	if err != nil {
+		glog.Errorf("purgeHistoSensor %d : %s", sensorId, err)
+		return
+	}
+	if glog.V(2) {
+		nb, _ := res.RowsAffected()
+		glog.Infof("purgeHistoSensor %d : %d values removed", sensorId, nb)
+	}
+}
+
+// purgeHistoRollup : remove rollups of a resolution older than before
+func purgeHistoRollup(db *sql.DB, resolution int64, before time.Time) {
+	if _, err := db.Exec("delete from HistoRollup where resolution = ? and ts < ?", resolution, before.Unix()); err != nil {
+		glog.Errorf("purgeHistoRollup %d : %s", resolution, err)
+	}
+}
+
+// purgeHistoActor : remove actor results older than before
+func purgeHistoActor(db *sql.DB, before time.Time) {
+	if _, err := db.Exec("delete from HistoActor where ts < ?", before.Unix()); err != nil {
+		glog.Errorf("purgeHistoActor : %s", err)
+	}
+}
@@ -20,6 +20,8 @@ const (
 	DBTypeFloat
 	DBTypeText
 	DBTypeDateTime
+	_          // 6 : DBTypeURL (www only)
+	DBTypeJSON // json object (multi-value sensors)
 )
 
 // -----------------------------------------------
@@ -78,6 +80,8 @@ func (obj HomeObject) getIntVal(fieldName string) (value int, err error) {
 			value, err = strconv.Atoi(obj.Values[idx].Val)
 		case DBTypeFloat:
 			err = errors.New(fmt.Sprintf("Not converting float to int for '%s' field", fieldName))
+		case DBTypeJSON:
+			err = errors.New(fmt.Sprintf("Not converting json to int for '%s' field", fieldName))
 		default:
 			err = errors.New(fmt.Sprintf("Unknown data type %d for '%s' field", obj.Fields[idx].IdDataType, fieldName))
 		}
@@ -109,7 +113,7 @@ func (obj HomeObject) getStrVal(fieldName string) (value string, err error) {
 			}
 		case DBTypeInt, DBTypeDateTime, DBTypeFloat:
 			value = fmt.Sprint(obj.Values[idx].Val)
-		case DBTypeText:
+		case DBTypeText, DBTypeJSON:
 			value = obj.Values[idx].Val
 		default:
 			err = errors.New(fmt.Sprintf("Unknown data type %d for '%s' field", obj.Fields[idx].IdDataType, fieldName))
@@ -124,6 +128,37 @@ func (obj HomeObject) getStrVal(fieldName string) (value string, err error) {
 	return
 }
 
+// getOptStrVal : return raw string value for fieldName or defVal if field or value is missing/empty
+// Use it for fields added after objects creation (existing objects may have no value for them)
+func (obj HomeObject) getOptStrVal(fieldName string, defVal string) string {
+	for _, f := range obj.Fields {
+		if f.Name != fieldName {
+			continue
+		}
+		for _, v := range obj.Values {
+			if v.IdField == f.IdField && len(v.Val) > 0 {
+				return v.Val
+			}
+		}
+		break
+	}
+	return defVal
+}
+
+// getOptIntVal : return integer value for fieldName or defVal if field or value is missing or not an integer
+func (obj HomeObject) getOptIntVal(fieldName string, defVal int) int {
+	strVal := obj.getOptStrVal(fieldName, "")
+	if len(strVal) <= 0 {
+		return defVal
+	}
+	value, err := strconv.Atoi(strVal)
+	if err != nil {
+		glog.Errorf("Bad int value '%s' for '%s' field (obj=%d) : %s", strVal, fieldName, obj.getId(), err)
+		return defVal
+	}
+	return value
+}
+
 // ValidateValues : check values are valid regarding obj.Fields
 // TODO HomeObject.ValidateValues
 func (obj HomeObject) ValidateValues(values []ItemFieldVal) (err error) {
@@ -132,6 +167,25 @@ func (obj HomeObject) ValidateValues(values []ItemFieldVal) (err error) {
 
 // -----------------------------------------------
 
+// alignValues : return values ordered as fields with an empty value for each field without value
+// Objects created before a field was added to the item definition have no value for this field
+func alignValues(fields []ItemField, values []ItemFieldVal) (aligned []ItemFieldVal) {
+	if len(values) <= 0 {
+		return values
+	}
+	for _, f := range fields {
+		val := ItemFieldVal{values[0].IdObject, f.IdField, ""}
+		for _, v := range values {
+			if v.IdField == f.IdField {
+				val = v
+				break
+			}
+		}
+		aligned = append(aligned, val)
+	}
+	return
+}
+
 // getLinkedObjects add to each objs[] corresponding linked objects
 // todo : reorg/optimisation : currently need 1 db query for each objs[] + 1 db query for each linked obj
 func getLinkedObjects(db *sql.DB, objs []HomeObject) (err error) {
@@ -198,12 +252,12 @@ func getHomeObjects(db *sql.DB, idItem TItemId, idObject int) (objs []HomeObject
 				if v.IdObject == curIdObject {
 					continue
 				}
-				curObj.Values = values[startIdx:i]
+				curObj.Values = alignValues(curObj.Fields, values[startIdx:i])
 				objs = append(objs, curObj)
 				startIdx = i
 				curIdObject = values[startIdx].IdObject
 			}
-			curObj.Values = values[startIdx:]
+			curObj.Values = alignValues(curObj.Fields, values[startIdx:])
 			objs = append(objs, curObj)
 		}
 
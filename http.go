@@ -80,6 +80,14 @@ const htmlAction = `
 		</tr></table>
 `
 
+const htmlConfirm = `
+		<form id="confirmform" action="#" method="POST">
+			<input type="hidden" name="usercode" value="%s">
+			<input type="hidden" name="objectid" value="%d">
+			<input type="hidden" name="token" value="%s">
+		</form>
+`
+
 const htmlFooter = `
 	</div>
 <!-- FOOTER -->
@@ -154,6 +162,16 @@ func sendActionPage(w http.ResponseWriter, onload string, userName string, userC
 	fmt.Fprintf(w, htmlFooter, time.Now().Format("2 Jan 2006 15:04:05") )
 	return
 }
+
+// sendConfirmPage : action page asking to confirm an action
+func sendConfirmPage(w http.ResponseWriter, confirm ActorConfirm, userName string, userCode string) {
+	onload := fmt.Sprintf("if (confirm('Action %d : confirm ?')) document.getElementById('confirmform').submit();", confirm.IdObject)
+	fmt.Fprintf(w, htmlHeader, onload, userName)
+	fmt.Fprintf(w, htmlConfirm, userCode, confirm.IdObject, confirm.Token)
+	fmt.Fprintf(w, htmlAction, userCode, userCode, userCode)
+	fmt.Fprintf(w, htmlFooter, time.Now().Format("2 Jan 2006 15:04:05") )
+	return
+}
 // -----------------------------------------------
 
 // simpleResponse : for simple HTTP client that can't handle modern css
@@ -240,8 +258,36 @@ func simpleResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Trigger asked action
-	result, err := triggerActorById(objectid, userObj.getId(), "")
+	// Trigger asked action (or confirm it), slow actor keeps running after page is sent
+	var job *actorJob
+	var actor HomeObject
+	var confirm ActorConfirm
+	if token, tokenErr := getFormStrVal(r.Form, "token", 0); tokenErr == nil {
+		job, err = confirmActor(token, objectid, userObj.getId(), false)
+	} else if actor, err = getActorById(objectid); err == nil {
+		// fails if actor needs a runtime parameter, not available here
+		_, err = checkActorParam(actor, "")
+		if err == nil && isActorConfirmRequired(actor) {
+			if confirm, err = requestActorConfirm(actor, userObj.getId(), ""); err == nil {
+				sendConfirmPage(w, confirm, userName, userCode)
+				return
+			}
+		} else if err == nil {
+			job = startActorJob(actor, userObj.getId(), "")
+		}
+	}
+	if err != nil {
+		if glog.V(2) {
+			glog.Infof("Trigger actionfail : %v",err)
+		}
+		sendActionPage(w, fmt.Sprintf("alert('Action %d : failed')",objectid), userName, userCode)
+		return
+	}
+	if !job.wait(apiTriggerActorWait) {
+		sendActionPage(w, fmt.Sprintf("alert('Action %d : running')",objectid), userName, userCode)
+		return
+	}
+	result, err := job.getResult()
 	if err != nil {
 		if glog.V(2) {
 			glog.Infof("Trigger actionfail : %v",err)
@@ -358,6 +404,41 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write(fctApiGetSensorVal(profil, jsonCmde, false))
 		return
 
+	case apiGetSensorActState:
+		if glog.V(2) {
+			glog.Infof("%s (objectid=%d)", jsonCmde.Command, jsonCmde.Objectid)
+		}
+		w.Write(fctApiGetSensorActState(profil, jsonCmde))
+		return
+
+	case apiGetSensorSchedule:
+		if glog.V(2) {
+			glog.Infof("%s (objectid=%d)", jsonCmde.Command, jsonCmde.Objectid)
+		}
+		w.Write(fctApiGetSensorSchedule(profil, jsonCmde))
+		return
+
+	case apiGetSchedule:
+		if glog.V(2) {
+			glog.Infof("%s (objectid=%d, param=%s)", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Jsonparam)
+		}
+		w.Write(fctApiGetSchedule(profil, jsonCmde))
+		return
+
+	case apiReplaySensorAct:
+		if glog.V(2) {
+			glog.Infof("%s (obj=%d, start=%d, end=%d)", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts)
+		}
+		w.Write(fctApiReplaySensorAct(profil, jsonCmde))
+		return
+
+	case apiEvalSensorAct:
+		if glog.V(2) {
+			glog.Infof("%s (obj=%d)", jsonCmde.Command, jsonCmde.Objectid)
+		}
+		w.Write(fctApiEvalSensorAct(profil, jsonCmde))
+		return
+
 	case apiReadHistoVal:
 		if glog.V(2) {
 			glog.Infof("%s (obj=%d, start=%d, end=%d)", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Startts, jsonCmde.Endts)
@@ -387,21 +468,11 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		writeApiError(w, "Delete not available : use apiSave* to toggle IsActive flag or use manual access to DB")
 		return
 
-	case apiSendSensorVal: // TODO
-		//		if glog.V(1) {
-		//			glog.Infof("%s (type=%d, item=%d, obj=%d)", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Value)
-		//		}
-
-		//		objs, err := getHomeObjects(nil, ItemNone, ItemIdNone, jsonCmde.Objectid)
-		//		if err != nil {
-		//			writeJsonError(w, fmt.Sprintf("%s failed for (%s) : %s", jsonCmde.Command, r.Form, err))
-		//			return
-		//		}
-
-		// Unmarchal jsonparam to SensorVal
-		// load sensor using getHomeObjects
-		// Call handleSensorValue(ts, sensor, value)
-		writeApiError(w, fmt.Sprintf("Command %s not ready", jsonCmde.Command))
+	case apiSendSensorVal:
+		if glog.V(2) {
+			glog.Infof("%s (objectid=%d)", jsonCmde.Command, jsonCmde.Objectid)
+		}
+		w.Write(fctApiSendSensorVal(profil, jsonCmde))
 		return
 
 	case apiTriggerActor:
@@ -411,6 +482,27 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write(fctApiTriggerActor(profil, userObj.getId(), jsonCmde))
 		return
 
+	case apiConfirmActor:
+		if glog.V(2) {
+			glog.Infof("%s (obj=%d)", jsonCmde.Command, jsonCmde.Objectid)
+		}
+		w.Write(fctApiConfirmActor(profil, userObj.getId(), jsonCmde))
+		return
+
+	case apiGetActorJob:
+		if glog.V(2) {
+			glog.Infof("%s (obj=%d, param=%s)", jsonCmde.Command, jsonCmde.Objectid, jsonCmde.Jsonparam)
+		}
+		w.Write(fctApiGetActorJob(profil, jsonCmde))
+		return
+
+	case apiCancelActorJob:
+		if glog.V(2) {
+			glog.Infof("%s (param=%s)", jsonCmde.Command, jsonCmde.Jsonparam)
+		}
+		w.Write(fctApiCancelActorJob(profil, jsonCmde))
+		return
+
 	default:
 		writeApiError(w, fmt.Sprintf("Unhandle command '%s' in (%s)", jsonCmde.Command, r.Form))
 		return
@@ -37,6 +37,11 @@ var goHomeExitChan = make(chan bool)
 // -----------------------------------------------
 
 var dbfile = flag.String("sqlite3", defaultSqlite3File, "full path to sqlite3 database file")
+var sysRoot = flag.String("sysroot", "/", "root of /proc and /sys trees read by system health sensors")
+var sensorWorkerNb = flag.Int("sensorworkers", 4, "max number of sensors read at the same time")
+var replayId = flag.Int("replay", 0, "replay recorded values through this sensorAct (no actor called) then exit")
+var replayFrom = flag.String("replayfrom", "", "replay start time YYYY-MM-DD [hh:mm[:ss]] (default one month ago)")
+var replayTo = flag.String("replayto", "", "replay end time YYYY-MM-DD [hh:mm[:ss]] (default now)")
 
 // Reminder : v flags for glog
 // -v=2
@@ -115,6 +120,24 @@ func main() {
 	}
 	defer db.Close()
 
+	// Replay mode : no server
+	if *replayId > 0 {
+		if err = replayCli(db, *replayId, *replayFrom, *replayTo); err != nil {
+			glog.Errorf("replay failed : %s", err)
+			fmt.Fprintf(os.Stderr, "replay failed : %s\n", err)
+		}
+		return
+	}
+
+	// Deferred first : drivers are closed after actor and sensor jobs are stopped
+	defer driverCleanup()
+
+	if err = actorSetup(db); err != nil {
+		glog.Errorf("actorSetup failed : %s ... exiting", err)
+		return
+	}
+	defer actorCleanup()
+
 	go startHTTPS(goHomeExitChan)
 
 	if err = sensorSetup(db); err != nil {
@@ -123,6 +146,21 @@ func main() {
 	}
 	defer sensorCleanup()
 
+	if err = scheduleSetup(db); err != nil {
+		glog.Errorf("scheduleSetup failed : %s ... exiting", err)
+		return
+	}
+	defer scheduleCleanup()
+
+	healthSetup()
+	defer healthCleanup()
+
+	if err = histoSetup(db); err != nil {
+		glog.Errorf("histoSetup failed : %s ... exiting", err)
+		return
+	}
+	defer histoCleanup()
+
 	if err = upnpSetup(db); err != nil {
 		glog.Errorf("upnpSetup failed : %s ... exiting", err)
 		return
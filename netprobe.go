@@ -0,0 +1,200 @@
+// netprobe.go
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Network probe internal sensor functions, ReadParam is a json ProbeParam
+//
+// TcpProbe  : {"addr":"10.0.0.53:8080"}                              tcp connect
+// HttpProbe : {"url":"http://10.0.0.53:8080/", "match":"ok"}         http(s) get, check status and body
+// DnsProbe  : {"name":"example.org", "expect":"93.184.216.34"}       name resolution
+//
+// Result "bool" (default) : 1 if probe succeed else 0
+// Result "ms"             : probe duration in ms, -1 if probe failed
+// Result "status"         : http status code, -1 if no response (HttpProbe only)
+// -----------------------------------------------
+
+type ProbeParam struct {
+	Addr     string // host:port (TcpProbe)
+	Url      string // url (HttpProbe)
+	Name     string // host name (DnsProbe)
+	Status   int    // expected http status, default 200 (HttpProbe)
+	Match    string // regexp the response body must match (HttpProbe)
+	Expect   string // expected address in resolved addresses (DnsProbe)
+	Insecure bool   // don't check server certificate (HttpProbe)
+	Timeout  int    // in ms, default 3000
+	Result   string // bool | ms | status
+}
+
+const probeDefaultTimeout = 3000
+const probeMaxBody = 1 << 20
+
+// probeTransports : HttpProbe transports by Insecure setting
+// Keep alive disabled : each probe opens (and closes) its own connection, nothing left idle between polls
+var probeTransports = map[bool]*http.Transport{
+	false: {DisableKeepAlives: true, TLSClientConfig: &tls.Config{}},
+	true:  {DisableKeepAlives: true, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+func init() {
+	RegisterInternalFunc(SensorFunc, "TcpProbe", TcpProbe)
+	RegisterInternalFunc(SensorFunc, "HttpProbe", HttpProbe)
+	RegisterInternalFunc(SensorFunc, "DnsProbe", DnsProbe)
+}
+
+// getProbeParam : unmarshal probe parameters and set default values
+func getProbeParam(fctName string, param1 string) (param ProbeParam, err error) {
+	if len(param1) <= 0 {
+		err = errors.New(fmt.Sprintf("%s : missing parameters", fctName))
+		glog.Error(err)
+		return
+	}
+	if err = json.Unmarshal([]byte(param1), &param); err != nil {
+		err = errors.New(fmt.Sprintf("%s : fail to unmarshal param '%s' : %s", fctName, param1, err))
+		glog.Error(err)
+		return
+	}
+	if param.Timeout <= 0 {
+		param.Timeout = probeDefaultTimeout
+	}
+	if len(param.Result) <= 0 {
+		param.Result = "bool"
+	}
+	switch param.Result {
+	case "bool", "ms":
+	case "status":
+		if fctName != "HttpProbe" {
+			err = errors.New(fmt.Sprintf("%s : result 'status' only available for HttpProbe", fctName))
+		}
+	default:
+		err = errors.New(fmt.Sprintf("%s : bad result '%s' (bool, ms or status)", fctName, param.Result))
+	}
+	return
+}
+
+// probeResult : format probe result according to param.Result
+func probeResult(fctName string, param ProbeParam, start time.Time, status int, probeErr error) (string, error) {
+	if probeErr != nil && glog.V(1) {
+		glog.Infof("%s failed : %s", fctName, probeErr)
+	}
+	switch param.Result {
+	case "ms":
+		if probeErr != nil {
+			return "-1", nil
+		}
+		return strconv.FormatInt(int64(time.Since(start)/time.Millisecond), 10), nil
+	case "status":
+		if status <= 0 {
+			return "-1", nil
+		}
+		return strconv.Itoa(status), nil
+	}
+	if probeErr != nil {
+		return "0", nil
+	}
+	return "1", nil
+}
+
+// -----------------------------------------------
+
+func TcpProbe(param1 string, param2 string) (string, error) {
+	param, err := getProbeParam("TcpProbe", param1)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", param.Addr, time.Duration(param.Timeout)*time.Millisecond)
+	if err == nil {
+		conn.Close()
+	}
+	return probeResult("TcpProbe", param, start, 0, err)
+}
+
+func HttpProbe(param1 string, param2 string) (string, error) {
+	param, err := getProbeParam("HttpProbe", param1)
+	if err != nil {
+		return "", err
+	}
+	if param.Status <= 0 {
+		param.Status = http.StatusOK
+	}
+	var match *regexp.Regexp
+	if len(param.Match) > 0 {
+		if match, err = regexp.Compile(param.Match); err != nil {
+			return "", errors.New(fmt.Sprintf("HttpProbe : bad match '%s' : %s", param.Match, err))
+		}
+	}
+
+	client := &http.Client{
+		Timeout:   time.Duration(param.Timeout) * time.Millisecond,
+		Transport: probeTransports[param.Insecure],
+	}
+
+	start := time.Now()
+	resp, err := client.Get(param.Url)
+	if err != nil {
+		return probeResult("HttpProbe", param, start, 0, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, probeMaxBody))
+	if err == nil && resp.StatusCode != param.Status {
+		err = errors.New(fmt.Sprintf("status %d (expected %d)", resp.StatusCode, param.Status))
+	}
+	if err == nil && match != nil && !match.Match(body) {
+		err = errors.New(fmt.Sprintf("body does not match '%s'", param.Match))
+	}
+	return probeResult("HttpProbe", param, start, resp.StatusCode, err)
+}
+
+func DnsProbe(param1 string, param2 string) (string, error) {
+	param, err := getProbeParam("DnsProbe", param1)
+	if err != nil {
+		return "", err
+	}
+
+	type lookupRes struct {
+		addrs []string
+		err   error
+	}
+	// net.LookupHost has no timeout
+	resChan := make(chan lookupRes, 1)
+	start := time.Now()
+	go func() {
+		addrs, err := net.LookupHost(param.Name)
+		resChan <- lookupRes{addrs, err}
+	}()
+
+	select {
+	case res := <-resChan:
+		err = res.err
+		if err == nil && len(param.Expect) > 0 {
+			err = errors.New(fmt.Sprintf("%s not in %v", param.Expect, res.addrs))
+			for _, addr := range res.addrs {
+				if addr == param.Expect {
+					err = nil
+					break
+				}
+			}
+		}
+	case <-time.After(time.Duration(param.Timeout) * time.Millisecond):
+		err = errors.New(fmt.Sprintf("timeout resolving %s", param.Name))
+	}
+	return probeResult("DnsProbe", param, start, 0, err)
+}
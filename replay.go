@@ -0,0 +1,198 @@
+// replay.go
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// SensorAct replay
+//
+// Master sensor values recorded in HistoSensor for a time range are evaluated, in order, with the sensorAct
+// condition and trigger rules (HoldCount, HoldDuration, ResetCondition, MinInterval) as if they were read
+// at their timestamp. Actors are never called, the sensorAct does not need to be active.
+// Other sensors referenced by sensor("name") use their recorded value at the same time.
+// Only values recorded by the master sensor record policy can be replayed.
+// Replay from API is limited to replayApiMaxValues values (no limit from command line).
+// -----------------------------------------------
+
+// replayApiMaxValues : max nb of values replayed by API (values are loaded in memory by the http handler)
+const replayApiMaxValues = 20000
+
+// ReplayTrigger : a would-be sensorAct trigger
+type ReplayTrigger struct {
+	Ts         int64 // unix time
+	PrevVal    string
+	LastVal    string
+	ActorParam string
+}
+
+// ReplayResult : result of a sensorAct replay
+type ReplayResult struct {
+	IdObject   int // sensorAct id
+	IdMaster   int // master sensor id
+	Startts    int64
+	Endts      int64
+	NbValues   int // nb of replayed values
+	NbTrue     int // nb of values with condition true
+	NbErrors   int // nb of values with condition eval error
+	Suppressed int // nb of values with condition true not triggering (debounce, hysteresis, cooldown)
+	Triggers   []ReplayTrigger
+}
+
+// replaySensorAct : replay master sensor values in [start, end] through sensorAct condition
+// Fail if there are more than maxValues values to replay (maxValues <= 0 : no limit)
+func replaySensorAct(db *sql.DB, sensorActId int, start time.Time, end time.Time, maxValues int) (result ReplayResult, err error) {
+	result = ReplayResult{IdObject: sensorActId, Startts: start.Unix(), Endts: end.Unix(), Triggers: []ReplayTrigger{}}
+
+	objs, err := getHomeObjects(db, ItemIdNone, sensorActId)
+	if err != nil {
+		return
+	}
+	if len(objs) <= 0 || objs[0].Fields[0].IdItem != ItemSensorAct {
+		err = errors.New(fmt.Sprintf("sensorAct %d not found", sensorActId))
+		return
+	}
+	sensorAct := objs[0]
+	if TSensorEvent(sensorAct.getOptIntVal("Event", 0)) != SensorEventValue {
+		err = errors.New(fmt.Sprintf("sensorAct %d : only sensorAct on new values can be replayed", sensorActId))
+		return
+	}
+
+	if result.IdMaster, err = sensorAct.getIntVal("idMasterObj"); err != nil {
+		return
+	}
+	objs, err = getHomeObjects(db, ItemIdNone, result.IdMaster)
+	if err != nil {
+		return
+	}
+	if len(objs) <= 0 {
+		err = errors.New(fmt.Sprintf("master sensor %d not found", result.IdMaster))
+		return
+	}
+	sensor := objs[0]
+
+	if maxValues > 0 {
+		var nb int
+		if nb, err = countHistoSensor(db, result.IdMaster, start, end); err != nil {
+			return
+		}
+		if nb > maxValues {
+			err = errors.New(fmt.Sprintf("too many values to replay (%d, max %d), reduce time range", nb, maxValues))
+			return
+		}
+	}
+
+	values, err := getHistoSensor(db, result.IdMaster, false, start, end)
+	if err != nil {
+		return
+	}
+
+	// Previous value of first replayed value
+	prevVal := ""
+	before, found, err := getHistoSensorAt(db, result.IdMaster, start.Add(-time.Second))
+	if err != nil {
+		return
+	}
+	if found {
+		prevVal = before.Val
+	} else if len(values) > 0 {
+		prevVal = values[0].Val
+	}
+
+	st := &sensorActState{IdObject: sensorActId, Armed: true}
+	hasReset := len(strings.TrimSpace(sensorAct.getOptStrVal("ResetCondition", ""))) > 0
+
+	for _, value := range values {
+		result.NbValues++
+		condition, actorParam, err := evalSensorAct(sensorAct, sensor, prevVal, value.Val, value.Ts, true)
+		if err != nil {
+			result.NbErrors++
+			if glog.V(2) {
+				glog.Infof("replaySensorAct #%d (%v) : %s", sensorActId, value.Ts, err)
+			}
+			prevVal = value.Val
+			continue
+		}
+
+		reset := false
+		if hasReset && !st.Armed {
+			if reset, err = evalSensorActReset(sensorAct, sensor, prevVal, value.Val, value.Ts, true); err != nil {
+				result.NbErrors++
+			}
+		}
+
+		if condition {
+			result.NbTrue++
+		}
+		if updateSensorActState(st, sensorAct, condition, reset, value.Ts) {
+			result.Triggers = append(result.Triggers, ReplayTrigger{value.Ts.Unix(), prevVal, value.Val, actorParam})
+		} else if condition {
+			result.Suppressed++
+		}
+		prevVal = value.Val
+	}
+
+	if glog.V(1) {
+		glog.Infof("replaySensorAct #%d : %d values, %d triggers", sensorActId, result.NbValues, len(result.Triggers))
+	}
+	return
+}
+
+// -----------------------------------------------
+
+// replayCli : run replay from command line (-replay) and print would-be triggers on stdout
+func replayCli(db *sql.DB, sensorActId int, from string, to string) (err error) {
+	end := time.Now()
+	start := end.AddDate(0, -1, 0)
+	if len(from) > 0 {
+		if start, err = parseReplayTime(from); err != nil {
+			return
+		}
+	}
+	if len(to) > 0 {
+		if end, err = parseReplayTime(to); err != nil {
+			return
+		}
+	}
+
+	// sensor("name") in conditions need registered sensors
+	sensors, err := getHomeObjects(db, ItemSensor, -1)
+	if err != nil {
+		return
+	}
+	for _, sensor := range sensors {
+		sensorRegister(sensor)
+	}
+
+	result, err := replaySensorAct(db, sensorActId, start, end, 0)
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("SensorAct #%d (master sensor #%d) from %s to %s\n", result.IdObject, result.IdMaster, start.Format(replayTimeFormat), end.Format(replayTimeFormat))
+	for _, trigger := range result.Triggers {
+		fmt.Printf("%s  prevVal=%s  lastVal=%s  actorParam=%s\n", time.Unix(trigger.Ts, 0).Format(replayTimeFormat), cleanSpaces(trigger.PrevVal), cleanSpaces(trigger.LastVal), trigger.ActorParam)
+	}
+	fmt.Printf("%d values, %d with condition true, %d triggers, %d suppressed, %d errors\n", result.NbValues, result.NbTrue, len(result.Triggers), result.Suppressed, result.NbErrors)
+	return
+}
+
+const replayTimeFormat = "2006-01-02 15:04:05"
+
+// parseReplayTime : parse "2006-01-02" or "2006-01-02 15:04[:05]" (local time)
+func parseReplayTime(value string) (t time.Time, err error) {
+	for _, layout := range []string{replayTimeFormat, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("bad time '%s' (expect YYYY-MM-DD [hh:mm[:ss]])", value))
+	return
+}
@@ -0,0 +1,270 @@
+// scene.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Scenes
+//
+// A scene is a sequence of actor calls, its 'Steps' field is a json array of SceneStep, i.e. :
+//   [{"actor":"Lights","param":"off"},{"delay":"30s","actor":"Garage"},{"actor":"SendSMS","param":"0123456789 @param@","continueOnError":true}]
+// Each step waits its delay, then calls its actor (as an actor job) if its condition is true. A failed step
+// stops the scene unless continueOnError is set. Tag @param@ in step param and condition is the scene
+// dynamic parameter.
+// A scene is triggered like an actor (TriggerActor, SensorAct, /simple page) and runs as an actor job
+// (default timeout sceneTimeout, cancellation stops the running step). Each step is recorded in HistoActor
+// as any actor call (status skipped if condition is false), the scene itself with its summary.
+// Step actors are called without confirmation nor access check : a step actor asking confirmation in a scene
+// without confirmation, or with a stricter profil than the scene, is refused when the scene is saved and the
+// step fails if the actor changed since.
+// -----------------------------------------------
+
+// TagSceneParam : scene dynamic parameter in step param and condition
+const TagSceneParam = "@param@"
+
+// VarSceneParam : scene dynamic parameter in step condition (used as @param@)
+const VarSceneParam = "param"
+
+// ActorJobSkipped : HistoActor status of a scene step with condition false
+const ActorJobSkipped TActorJobStatus = "skipped"
+
+// sceneTimeout : default max duration of a scene
+const sceneTimeout = 10 * time.Minute
+
+// SceneStep : one step of a scene
+type SceneStep struct {
+	Actor           string // actor name, empty for a delay only step
+	Param           string // actor dynamic parameter
+	Delay           string // wait before the step (i.e. 30s)
+	Condition       string // step skipped if false
+	ContinueOnError bool   // go on with next step if actor fails
+	delay           time.Duration
+	condition       *exprProgram
+}
+
+// -----------------------------------------------
+
+// isScene : check if an actor object is a scene
+func isScene(obj HomeObject) bool {
+	return len(obj.Fields) > 0 && obj.Fields[0].IdItem == ItemScene
+}
+
+// getSceneSteps : unmarshal and check scene steps
+func getSceneSteps(scene HomeObject) (steps []SceneStep, err error) {
+	stepsStr, err := scene.getStrVal("Steps")
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(stepsStr), &steps); err != nil {
+		err = errors.New(fmt.Sprintf("Scene : fail to unmarshal steps '%s' : %s", stepsStr, err))
+		return
+	}
+	if len(steps) <= 0 {
+		err = errors.New("Scene : no step")
+		return
+	}
+
+	for i := range steps {
+		step := &steps[i]
+		if delay := strings.TrimSpace(step.Delay); len(delay) > 0 {
+			if step.delay, err = time.ParseDuration(delay); err != nil || step.delay < 0 {
+				err = errors.New(fmt.Sprintf("Scene : step %d : bad delay '%s'", i+1, step.Delay))
+				return
+			}
+		}
+		if len(step.Actor) <= 0 {
+			if step.delay <= 0 {
+				err = errors.New(fmt.Sprintf("Scene : step %d : no actor nor delay", i+1))
+				return
+			}
+			continue
+		}
+		if condition := strings.TrimSpace(step.Condition); len(condition) > 0 {
+			if step.condition, err = exprCompile(condition, map[string]exprType{VarSceneParam: exprString}); err != nil {
+				err = errors.New(fmt.Sprintf("Scene : step %d : condition error : %s", i+1, err))
+				return
+			}
+			if step.condition.Type() != exprBool {
+				err = errors.New(fmt.Sprintf("Scene : step %d : condition '%s' is not a bool expression", i+1, condition))
+				return
+			}
+		}
+	}
+	return
+}
+
+// getSceneActors : actors used by scene steps, by name
+func getSceneActors(steps []SceneStep) (actors map[string]HomeObject, err error) {
+	objs, err := getHomeObjects(nil, ItemActor, -1)
+	if err != nil {
+		return
+	}
+	byName := map[string]HomeObject{}
+	for _, obj := range objs {
+		byName[obj.getOptStrVal("Name", "")] = obj
+	}
+
+	actors = map[string]HomeObject{}
+	for i, step := range steps {
+		if len(step.Actor) <= 0 {
+			continue
+		}
+		actor, found := byName[step.Actor]
+		if !found {
+			err = errors.New(fmt.Sprintf("Scene : step %d : no actor named '%s'", i+1, step.Actor))
+			return
+		}
+		actors[step.Actor] = actor
+	}
+	return
+}
+
+// checkScene : check scene steps and timeout
+func checkScene(scene HomeObject) (err error) {
+	steps, err := getSceneSteps(scene)
+	if err != nil {
+		return
+	}
+	actors, err := getSceneActors(steps)
+	if err != nil {
+		return
+	}
+	for i, step := range steps {
+		actor, found := actors[step.Actor]
+		if !found {
+			continue
+		}
+		if err = checkSceneStepActor(scene, actor); err != nil {
+			err = errors.New(fmt.Sprintf("Scene : step %d : %s", i+1, err))
+			return
+		}
+	}
+	return checkActorTimeout(scene)
+}
+
+// checkSceneStepActor : check a step actor can be called by the scene (when saved and before each call)
+// Steps call their actor directly : a step actor asking confirmation needs a scene asking confirmation, and
+// a step actor can't have a stricter profil than the scene (or users could call it through the scene)
+func checkSceneStepActor(scene HomeObject, actor HomeObject) error {
+	actorName := actor.getOptStrVal("Name", "")
+	if isActorConfirmRequired(actor) && !isActorConfirmRequired(scene) {
+		return errors.New(fmt.Sprintf("actor '%s' asks confirmation, scene must ask confirmation", actorName))
+	}
+	// scene with profil none is not called by users
+	sceneProfil := TUserProfil(scene.getOptIntVal("IdProfil", ProfilNone))
+	if sceneProfil != ProfilNone && checkAccessToObject(sceneProfil, actor) != nil {
+		return errors.New(fmt.Sprintf("actor '%s' profil is stricter than scene profil", actorName))
+	}
+	return nil
+}
+
+// -----------------------------------------------
+
+// runScene : run scene steps in order until a step fails or ctx is done, result is a summary of steps
+func runScene(ctx context.Context, scene HomeObject, userId int, param string) (result string, err error) {
+	sceneId := scene.getId()
+	steps, err := getSceneSteps(scene)
+	if err != nil {
+		return
+	}
+	actors, err := getSceneActors(steps)
+	if err != nil {
+		return
+	}
+
+	var results []string
+	nbDone, nbSkipped, nbErrors := 0, 0, 0
+	defer func() {
+		result = fmt.Sprintf("%d done, %d skipped, %d errors", nbDone, nbSkipped, nbErrors)
+		if len(results) > 0 {
+			result += " : " + strings.Join(results, ", ")
+		}
+	}()
+
+	for i, step := range steps {
+		if step.delay > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case <-time.After(step.delay):
+			}
+		}
+		if len(step.Actor) <= 0 {
+			continue
+		}
+		actor := actors[step.Actor]
+		stepParam := strings.Replace(step.Param, TagSceneParam, param, -1)
+
+		// actor may have changed since the scene was saved
+		if checkErr := checkSceneStepActor(scene, actor); checkErr != nil {
+			nbErrors++
+			checkErr = errors.New(fmt.Sprintf("scene %d : step %d : %s", sceneId, i+1, checkErr))
+			if !step.ContinueOnError {
+				err = checkErr
+				return
+			}
+			glog.Error(checkErr)
+			continue
+		}
+
+		if step.condition != nil {
+			ok, condErr := step.condition.EvalBool(exprEnv{vars: map[string]interface{}{VarSceneParam: param}})
+			if condErr != nil {
+				nbErrors++
+				condErr = errors.New(fmt.Sprintf("scene %d : step %d (%s) : condition error : %s", sceneId, i+1, step.Actor, condErr))
+				if !step.ContinueOnError {
+					err = condErr
+					return
+				}
+				glog.Error(condErr)
+				continue
+			}
+			if !ok {
+				nbSkipped++
+				if glog.V(1) {
+					glog.Infof("Scene %d : step %d (%s) skipped", sceneId, i+1, step.Actor)
+				}
+				now := time.Now()
+				state := ActorJobState{IdObject: actor.getId(), IdUser: userId, Param: stepParam, Status: ActorJobSkipped, Result: "Condition false"}
+				recordActorResult(state, now, now, time.Time{})
+				continue
+			}
+		}
+
+		stepJob := startActorJob(actor, userId, stepParam)
+		select {
+		case <-ctx.Done():
+			stepJob.Cancel()
+			stepJob.getResult()
+			err = ctx.Err()
+			return
+		case <-stepJob.done:
+		}
+		stepResult, stepErr := stepJob.getResult()
+		results = append(results, fmt.Sprintf("%s=%s", step.Actor, cleanSpaces(stepResult)))
+		if stepErr != nil {
+			nbErrors++
+			if !step.ContinueOnError {
+				err = errors.New(fmt.Sprintf("scene %d : step %d (%s) failed : %s", sceneId, i+1, step.Actor, stepErr))
+				return
+			}
+			continue
+		}
+		nbDone++
+	}
+
+	if glog.V(1) {
+		glog.Infof("Scene %d : %d steps done, %d skipped, %d errors", sceneId, nbDone, nbSkipped, nbErrors)
+	}
+	return
+}
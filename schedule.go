@@ -0,0 +1,340 @@
+// schedule.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Schedules
+//
+// A Schedule object triggers an actor (or a scene) with its 'ActorParam' :
+// - at each date/time matching its 'Schedule' (crontab like, see cron.go)
+// - or only once at 'RunAt' (YYYY-MM-DD hh:mm, local time), the schedule is then set inactive
+// Each active schedule has a scheduleJob waiting for its next run. Actor job is not waited for and runs as
+// the system user (as for sensorAct). When 'SkipNext' is set, next run is skipped and SkipNext is reset.
+// Schedules are read from DB at startup and each change (SkipNext reset, run once done) is saved, so
+// upcoming runs survive restarts. A run once schedule whose RunAt was missed (server down) is not run.
+// -----------------------------------------------
+
+// scheduleRunAtLayout : RunAt format
+const scheduleRunAtLayout = "2006-01-02 15:04"
+
+// scheduleMaxRuns : max upcoming runs listed by API
+const scheduleMaxRuns = 50
+
+// ScheduleState : state of an active schedule
+type ScheduleState struct {
+	IdObject  int
+	Name      string
+	IdActor   int
+	Param     string
+	Schedule  string  // crontab like schedule, or RunAt for a run once schedule
+	Once      bool    // run once at RunAt
+	SkipNext  bool    // next run will be skipped
+	NextRun   int64   // unix time, 0 if no more run
+	NextRuns  []int64 // upcoming runs (unix time) when asked, first one is skipped if SkipNext
+	LastRun   int64   // unix time, 0 if not run since server start
+	LastJobId int64   // actor job of last run
+	LastError string  // empty if last run succeed
+}
+
+// scheduleJob : trigger schedule actor at each run
+type scheduleJob struct {
+	schedule HomeObject
+	sched    *cronSchedule // nil for a run once schedule
+	runAt    time.Time
+	cancel   context.CancelFunc
+	lock     sync.Mutex
+	state    ScheduleState
+}
+
+var scheduleJobsLock sync.Mutex
+var scheduleJobs = map[int]*scheduleJob{}
+
+// -----------------------------------------------
+
+// scheduleSetup : start jobs for active schedules
+func scheduleSetup(db *sql.DB) (err error) {
+	schedules, err := getHomeObjects(db, ItemSchedule, -1)
+	if err != nil {
+		return
+	}
+	for _, schedule := range schedules {
+		scheduleUpdate(schedule)
+	}
+
+	if glog.V(1) {
+		glog.Infof("scheduleSetup Done (%d)", len(scheduleJobs))
+	}
+	return
+}
+
+// scheduleCleanup : stop schedule jobs
+func scheduleCleanup() {
+	scheduleJobsLock.Lock()
+	for scheduleId, job := range scheduleJobs {
+		job.cancel()
+		delete(scheduleJobs, scheduleId)
+	}
+	scheduleJobsLock.Unlock()
+
+	if glog.V(1) {
+		glog.Info("scheduleCleanup Done")
+	}
+}
+
+// scheduleUpdate : (re)start schedule job after a change, stop it if schedule is inactive or invalid
+func scheduleUpdate(schedule HomeObject) (err error) {
+	scheduleId := schedule.getId()
+
+	scheduleJobsLock.Lock()
+	defer scheduleJobsLock.Unlock()
+
+	prev, found := scheduleJobs[scheduleId]
+	if found {
+		prev.cancel()
+		delete(scheduleJobs, scheduleId)
+	}
+
+	if schedule.getOptIntVal("IsActive", 0) == 0 {
+		return
+	}
+	job, err := newScheduleJob(schedule)
+	if err != nil {
+		glog.Errorf("Schedule %d : %s", scheduleId, err)
+		return
+	}
+	if found {
+		// keep last run
+		state := prev.getState()
+		job.state.LastRun, job.state.LastJobId, job.state.LastError = state.LastRun, state.LastJobId, state.LastError
+	}
+	next, ok := job.next(time.Now())
+	if !ok {
+		glog.Infof("Schedule %d : RunAt %s is over, not scheduled", scheduleId, job.state.Schedule)
+		return
+	}
+	job.state.NextRun = next.Unix()
+
+	var ctx context.Context
+	ctx, job.cancel = context.WithCancel(context.Background())
+	scheduleJobs[scheduleId] = job
+	go job.run(ctx)
+
+	if glog.V(1) {
+		glog.Infof("Schedule %d : %s, actor %d (%s)", scheduleId, job.state.Schedule, job.state.IdActor, job.state.Param)
+	}
+	return
+}
+
+// newScheduleJob : job for schedule, not started
+func newScheduleJob(schedule HomeObject) (job *scheduleJob, err error) {
+	job = &scheduleJob{schedule: schedule}
+	job.state.IdObject = schedule.getId()
+	job.state.Name = schedule.getOptStrVal("Name", "")
+	job.state.Param = schedule.getOptStrVal("ActorParam", "")
+	job.state.SkipNext = schedule.getOptIntVal("SkipNext", 0) != 0
+	if job.state.IdActor, err = schedule.getIntVal("idActor"); err != nil {
+		return
+	}
+
+	runAt := strings.TrimSpace(schedule.getOptStrVal("RunAt", ""))
+	spec := strings.TrimSpace(schedule.getOptStrVal("Schedule", ""))
+	switch {
+	case len(runAt) > 0 && len(spec) > 0:
+		err = errors.New("Schedule and RunAt are exclusive")
+	case len(runAt) > 0:
+		job.state.Schedule, job.state.Once = runAt, true
+		if job.runAt, err = time.ParseInLocation(scheduleRunAtLayout, runAt, time.Local); err != nil {
+			err = errors.New(fmt.Sprintf("bad RunAt '%s' (expect YYYY-MM-DD hh:mm)", runAt))
+		}
+	case len(spec) > 0:
+		job.state.Schedule = spec
+		if job.sched, err = parseCronSchedule(spec); err == nil {
+			_, err = job.sched.Next(time.Now())
+		}
+	default:
+		err = errors.New("no Schedule nor RunAt")
+	}
+	return
+}
+
+// checkSchedule : check schedule actor and Schedule / RunAt
+func checkSchedule(schedule HomeObject) (err error) {
+	job, err := newScheduleJob(schedule)
+	if err != nil {
+		return
+	}
+	if _, ok := job.next(time.Now()); !ok && schedule.getOptIntVal("IsActive", 0) != 0 {
+		return errors.New(fmt.Sprintf("RunAt %s is over", job.state.Schedule))
+	}
+	actor, err := getActorById(job.state.IdActor)
+	if err != nil {
+		return
+	}
+	_, err = checkActorParam(actor, job.state.Param)
+	return
+}
+
+// -----------------------------------------------
+
+// run : trigger actor at each run until ctx is cancelled or run once is done
+func (job *scheduleJob) run(ctx context.Context) {
+	for {
+		next, ok := job.next(time.Now())
+		if !ok {
+			return
+		}
+		job.lock.Lock()
+		job.state.NextRun = next.Unix()
+		job.lock.Unlock()
+
+		timer := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		job.trigger(next)
+
+		if job.sched == nil {
+			// run once done : schedule is set inactive
+			job.lock.Lock()
+			job.state.NextRun = 0
+			job.lock.Unlock()
+			setScheduleVal(job.state.IdObject, "IsActive", "0")
+			scheduleJobsLock.Lock()
+			if scheduleJobs[job.state.IdObject] == job {
+				delete(scheduleJobs, job.state.IdObject)
+			}
+			scheduleJobsLock.Unlock()
+			return
+		}
+	}
+}
+
+// trigger : start schedule actor job, or skip this run if SkipNext is set
+func (job *scheduleJob) trigger(t time.Time) {
+	job.lock.Lock()
+	skip := job.state.SkipNext
+	job.state.SkipNext = false
+	job.lock.Unlock()
+
+	if skip {
+		glog.Infof("Schedule %d : run %s skipped", job.state.IdObject, t.Format(scheduleRunAtLayout))
+		setScheduleVal(job.state.IdObject, "SkipNext", "0")
+		return
+	}
+
+	// Actor job not waited for : next run is not delayed by actor
+	actorJob, err := startActorJobById(job.state.IdActor, 1, job.state.Param)
+
+	var jobId int64
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	} else {
+		jobId = actorJob.getState().JobId
+	}
+
+	job.lock.Lock()
+	job.state.LastRun = t.Unix()
+	job.state.LastJobId = jobId
+	job.state.LastError = lastError
+	job.lock.Unlock()
+
+	if err != nil {
+		glog.Errorf("Schedule %d : %s", job.state.IdObject, err)
+		return
+	}
+	if glog.V(1) {
+		glog.Infof("Schedule %d : launching Actor #%d (job #%d)", job.state.IdObject, job.state.IdActor, jobId)
+	}
+}
+
+// next : next run strictly after t, false if no more run
+func (job *scheduleJob) next(t time.Time) (next time.Time, ok bool) {
+	if job.sched == nil {
+		return job.runAt, job.runAt.After(t)
+	}
+	next, err := job.sched.Next(t)
+	return next, err == nil
+}
+
+// nextRuns : at most count upcoming runs after t
+func (job *scheduleJob) nextRuns(t time.Time, count int) (runs []int64) {
+	for len(runs) < count {
+		next, ok := job.next(t)
+		if !ok {
+			break
+		}
+		runs = append(runs, next.Unix())
+		t = next
+	}
+	return
+}
+
+// getState : copy of job state
+func (job *scheduleJob) getState() ScheduleState {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.state
+}
+
+// -----------------------------------------------
+
+// getSchedules : state of active schedules with their count upcoming runs, sorted by id
+func getSchedules(count int) (states []ScheduleState) {
+	if count > scheduleMaxRuns {
+		count = scheduleMaxRuns
+	}
+	now := time.Now()
+
+	scheduleJobsLock.Lock()
+	for _, job := range scheduleJobs {
+		state := job.getState()
+		state.NextRuns = job.nextRuns(now, count)
+		states = append(states, state)
+	}
+	scheduleJobsLock.Unlock()
+
+	sort.Slice(states, func(i, j int) bool { return states[i].IdObject < states[j].IdObject })
+	return
+}
+
+// getScheduleObject : schedule object of an active schedule
+func getScheduleObject(scheduleId int) (schedule HomeObject, found bool) {
+	scheduleJobsLock.Lock()
+	defer scheduleJobsLock.Unlock()
+	job, found := scheduleJobs[scheduleId]
+	if found {
+		schedule = job.schedule
+	}
+	return
+}
+
+// setScheduleVal : save a schedule field value changed by its job (SkipNext, IsActive)
+func setScheduleVal(scheduleId int, fieldName string, val string) {
+	db, err := openDB()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	_, err = db.Exec("insert or replace into ItemFieldVal (idObject, idField, Val) select ?, f.idField, ? from ItemField f where f.idItem = ? and f.Name = ?;",
+		scheduleId, val, ItemSchedule, fieldName)
+	if err != nil {
+		glog.Errorf("Fail to save %s for schedule %d : %s", fieldName, scheduleId, err)
+	}
+}
@@ -0,0 +1,258 @@
+// scheduler.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// Sensor scheduler
+//
+// Each active sensor with a Schedule or an Interval has a sensorJob : a goroutine reading the sensor at each tick
+// until the job is stopped (its context is cancelled). Interval sensors start after a random delay (up to
+// sensorMaxJitter) so sensors with the same interval are not all read at the same time.
+// Each reading :
+// - waits for a free worker : at most -sensorworkers readings at the same time
+// - is cancelled (external command killed) after sensor 'Timeout' (default driverCallTimeout)
+// Readings outside a job (API, computed sensors) also use a worker and the sensor timeout (readSensorWithWorker).
+// A tick happening while previous reading is still running is skipped.
+// -----------------------------------------------
+
+const sensorMaxJitter = 10 * time.Second
+
+var sensorWorkersOnce sync.Once
+var sensorWorkers chan struct{}
+
+// SensorJobState : scheduling state of a sensor
+type SensorJobState struct {
+	IdObject     int
+	Name         string
+	Schedule     string // Schedule or Interval
+	NextRun      int64  // unix time
+	LastRun      int64  // unix time, 0 if not run yet
+	LastDuration int64  // in ms
+	LastError    string // empty if last reading succeed
+	Running      bool
+}
+
+// sensorJob : read a sensor on schedule, a sensorTicker
+type sensorJob struct {
+	sensor HomeObject
+	cancel context.CancelFunc
+	lock   sync.Mutex
+	state  SensorJobState
+}
+
+// -----------------------------------------------
+
+// newSensorJob : start reading sensor using sched if not nil, else every interval
+func newSensorJob(sensor HomeObject, sched *cronSchedule, interval time.Duration) *sensorJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &sensorJob{sensor: sensor, cancel: cancel}
+	job.state.IdObject = sensor.getId()
+	job.state.Name = sensor.getOptStrVal("Name", "")
+	if sched != nil {
+		job.state.Schedule = strings.TrimSpace(sensor.getOptStrVal("Schedule", ""))
+	} else {
+		job.state.Schedule = interval.String()
+	}
+	go job.run(ctx, sched, interval)
+	return job
+}
+
+// Stop : stop the job, a running reading is cancelled
+func (job *sensorJob) Stop() {
+	job.cancel()
+}
+
+// getState : copy of job state
+func (job *sensorJob) getState() SensorJobState {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.state
+}
+
+func (job *sensorJob) setNextRun(next time.Time) {
+	job.lock.Lock()
+	job.state.NextRun = next.Unix()
+	job.lock.Unlock()
+}
+
+// run : read sensor at each tick until ctx is cancelled
+func (job *sensorJob) run(ctx context.Context, sched *cronSchedule, interval time.Duration) {
+	var tickerC <-chan time.Time
+	if sched != nil {
+		ticker := newCronTicker(sched)
+		defer ticker.Stop()
+		tickerC = ticker.C
+		if next, err := sched.Next(time.Now()); err == nil {
+			job.setNextRun(next)
+		}
+	} else {
+		// Start jitter then first reading
+		jitter := getSensorJitter(interval)
+		job.setNextRun(time.Now().Add(jitter))
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-time.After(jitter):
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tickerC = ticker.C
+			job.setNextRun(t.Add(interval))
+			job.read(ctx, t)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-tickerC:
+			if !ok {
+				return
+			}
+			if sched != nil {
+				if next, err := sched.Next(t); err == nil {
+					job.setNextRun(next)
+				}
+			} else {
+				job.setNextRun(t.Add(interval))
+			}
+			job.read(ctx, t)
+		}
+	}
+}
+
+// read : read sensor value using a worker, then handleSensorValue
+func (job *sensorJob) read(ctx context.Context, t time.Time) {
+	if !acquireSensorWorker(ctx) {
+		return
+	}
+	defer releaseSensorWorker()
+
+	job.lock.Lock()
+	job.state.Running = true
+	job.lock.Unlock()
+
+	start := time.Now()
+	readCtx, cancel := context.WithTimeout(ctx, getSensorTimeout(job.sensor))
+	result, err := readSensorValue(readCtx, job.sensor)
+	cancel()
+
+	job.lock.Lock()
+	job.state.Running = false
+	job.state.LastRun = start.Unix()
+	job.state.LastDuration = int64(time.Since(start) / time.Millisecond)
+	job.state.LastError = ""
+	if err != nil {
+		job.state.LastError = err.Error()
+	}
+	job.lock.Unlock()
+
+	if ctx.Err() != nil {
+		// job stopped while reading
+		return
+	}
+	if err != nil {
+		glog.Errorf("readSensor %d fail : %s", job.state.IdObject, err)
+		sensorHealthFailed(job.sensor, err)
+		return
+	}
+	handleSensorValue(t, job.sensor, result)
+}
+
+// -----------------------------------------------
+
+// acquireSensorWorker : wait for a free worker, false if ctx is done first
+func acquireSensorWorker(ctx context.Context) bool {
+	sensorWorkersOnce.Do(func() {
+		nb := *sensorWorkerNb
+		if nb <= 0 {
+			nb = 1
+		}
+		sensorWorkers = make(chan struct{}, nb)
+	})
+	select {
+	case sensorWorkers <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseSensorWorker : free a worker acquired with acquireSensorWorker
+func releaseSensorWorker() {
+	<-sensorWorkers
+}
+
+// readSensorWithWorker : read sensor outside its job (API, computed sensor, ...) using a worker
+// Waiting for the worker and reading are cancelled after sensor timeout (or when ctx is done)
+func readSensorWithWorker(ctx context.Context, sensor HomeObject) (result string, err error) {
+	readCtx, cancel := context.WithTimeout(ctx, getSensorTimeout(sensor))
+	defer cancel()
+	if !acquireSensorWorker(readCtx) {
+		return "", errors.New(fmt.Sprintf("sensor %d : no free worker (%s)", sensor.getId(), readCtx.Err()))
+	}
+	defer releaseSensorWorker()
+	return readSensorValue(readCtx, sensor)
+}
+
+// getSensorJitter : random start delay for an interval sensor
+func getSensorJitter(interval time.Duration) time.Duration {
+	max := interval
+	if max > sensorMaxJitter {
+		max = sensorMaxJitter
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// getSensorTimeout : sensor 'Timeout' or driverCallTimeout if not set (or invalid)
+func getSensorTimeout(sensor HomeObject) time.Duration {
+	timeoutStr := strings.TrimSpace(sensor.getOptStrVal("Timeout", ""))
+	if len(timeoutStr) <= 0 {
+		return driverCallTimeout
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout <= 0 {
+		glog.Errorf("Bad timeout (%s) for sensor %d, using %v", timeoutStr, sensor.getId(), driverCallTimeout)
+		return driverCallTimeout
+	}
+	return timeout
+}
+
+// checkSensorTimeout : check sensor timeout (if any) is a valid duration
+func checkSensorTimeout(sensor HomeObject) (err error) {
+	timeoutStr := strings.TrimSpace(sensor.getOptStrVal("Timeout", ""))
+	if len(timeoutStr) <= 0 {
+		return
+	}
+	_, err = time.ParseDuration(timeoutStr)
+	return
+}
+
+// getSensorSchedule : state of scheduled sensors, sorted by id
+func getSensorSchedule() (states []SensorJobState) {
+	sensorTickersLock.Lock()
+	for _, ticker := range sensorTickers {
+		if job, ok := ticker.(*sensorJob); ok {
+			states = append(states, job.getState())
+		}
+	}
+	sensorTickersLock.Unlock()
+
+	sort.Slice(states, func(i, j int) bool { return states[i].IdObject < states[j].IdObject })
+	return
+}
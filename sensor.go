@@ -2,13 +2,12 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"go/constant"
-	"go/token"
-	"go/types"
-	"os"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,31 +18,62 @@ import (
 
 // -----------------------------------------------
 
-const (
-	TagSensorName = "@sensorName@"
-	TagPrevVal    = "@prevVal@"
-	TagLastVal    = "@lastVal@"
-	TagCondition  = "@condition@"
-)
-
-// -----------------------------------------------
+// sensorTicker : *sensorJob (sensor 'Interval' or 'Schedule') or *fileWatcher (FileWatch sensor)
+type sensorTicker interface {
+	Stop()
+}
 
 var sensorTickersLock sync.Mutex
-var sensorTickers = map[int]*time.Ticker{}
+var sensorTickers = map[int]sensorTicker{}
 
 var sensorPrevValLock sync.Mutex
 var sensorPrevVal = map[int]string{}
+var sensorPrevTs = map[int]time.Time{} // time of sensorPrevVal, older readings are only recorded
 
-// -----------------------------------------------
+var sensorLastRecLock sync.Mutex
+var sensorLastRec = map[int]HistoSensor{}
+
+// All defined sensors by id (active or not), used to resolve sensor("name") in sensorAct conditions
+var sensorRegistryLock sync.Mutex
+var sensorRegistry = map[int]HomeObject{}
 
-func init() {
-	RegisterInternalFunc(SensorFunc, "CpuUsage", CpuUsage)
-	RegisterInternalFunc(SensorFunc, "MemoryUsage", MemoryUsage)
+// sensorActWatch : a sensorAct whose condition reads another sensor than its master
+type sensorActWatch struct {
+	sensorAct HomeObject
+	masterId  int
 }
 
-// sensorSetup : read defined sensors from DB then create a ticker and start reading goroutine for each sensor
+// sensorActWatches : by referenced sensor id, the sensorAct to re-evaluate when that sensor value change
+var sensorActWatchesLock sync.Mutex
+var sensorActWatches = map[int][]sensorActWatch{}
+
+// sensorCreateLastVal : last value of sensors not recording (KeepLastVal), one row per sensor
+const sensorCreateLastVal = "create table if not exists SensorLastVal (idObject integer not null primary key, ts datetime not null, Val text);"
+
+// -----------------------------------------------
+
+// TRecordMode : sensor recording policy (sensor 'Record' field)
+type TRecordMode int
+
+const (
+	RecordNever    TRecordMode = iota // never record
+	RecordAlways                      // record each reading
+	RecordOnChange                    // record only if value differs from last recorded value
+	RecordDeadband                    // record only if numeric value moved by at least 'RecordDelta' since last record
+	RecordSampled                     // record if value changed or if 'RecordInterval' elapsed since last record
+)
+
+// -----------------------------------------------
+
+// sensorSetup : read defined sensors from DB then start a job reading each sensor
 func sensorSetup(db *sql.DB) (err error) {
 
+	// DB created before SensorLastVal
+	if _, err = db.Exec(sensorCreateLastVal); err != nil {
+		glog.Errorf("sensorSetup : %s : %s", sensorCreateLastVal, err)
+		return
+	}
+
 	sensorObjs, err := getHomeObjects(db, ItemSensor, -1)
 	if err != nil {
 		return
@@ -52,7 +82,13 @@ func sensorSetup(db *sql.DB) (err error) {
 		glog.Info("\nSensor Objs\n", sensorObjs)
 	}
 
+	// Register all sensors first, so sensorAct conditions can reference any of them
+	for _, sensor := range sensorObjs {
+		sensorRegister(sensor)
+	}
+
 	for _, sensor := range sensorObjs {
+		sensorLoadLastValue(db, sensor)
 		sensorUpdateTicker(sensor)
 	}
 
@@ -63,7 +99,166 @@ func sensorSetup(db *sql.DB) (err error) {
 	return
 }
 
+// sensorLoadLastValue : init sensor previous value and last recorded value using last value stored in HistoSensor (if any)
+// The previous value is the newest of last value in HistoSensor and last value kept in SensorLastVal (KeepLastVal)
+// So edge conditions (i.e. @lastVal@ < @prevVal@) still work across restart
+func sensorLoadLastValue(db *sql.DB, sensor HomeObject) {
+	sensorId := sensor.getId()
+
+	var last HistoSensor
+	values, err := getHistoSensor(db, sensorId, true, time.Time{}, time.Time{})
+	recorded := err == nil && len(values) > 0
+	if recorded {
+		last = values[len(values)-1]
+	}
+	prev := last
+	if kept, found, err := getSensorLastVal(db, sensorId); err == nil && found && (!recorded || kept.Ts.After(last.Ts)) {
+		prev = kept
+	} else if !recorded {
+		return
+	}
+
+	sensorPrevValLock.Lock()
+	if _, found := sensorPrevVal[sensorId]; !found {
+		sensorPrevVal[sensorId] = prev.Val
+		sensorPrevTs[sensorId] = prev.Ts
+	}
+	sensorPrevValLock.Unlock()
+
+	if recorded {
+		sensorLastRecLock.Lock()
+		if _, found := sensorLastRec[sensorId]; !found {
+			sensorLastRec[sensorId] = last
+		}
+		sensorLastRecLock.Unlock()
+	}
+
+	if glog.V(2) {
+		glog.Infof("sensorLoadLastValue %d : %s (%v)", sensorId, prev.Val, prev.Ts)
+	}
+}
+
+// sensorRegister : add or replace sensor in sensorRegistry
+func sensorRegister(sensor HomeObject) {
+	sensorRegistryLock.Lock()
+	sensorRegistry[sensor.getId()] = sensor
+	sensorRegistryLock.Unlock()
+}
+
+// getSensorByName : find a sensor in sensorRegistry using its name
+func getSensorByName(name string) (sensor HomeObject, found bool) {
+	sensorRegistryLock.Lock()
+	defer sensorRegistryLock.Unlock()
+	for _, obj := range sensorRegistry {
+		if objName, err := obj.getStrVal("Name"); err == nil && objName == name {
+			return obj, true
+		}
+	}
+	return
+}
+
+// getSensorExprValue : last value of named sensor, converted for expression evaluation
+func getSensorExprValue(name string) (val interface{}, err error) {
+	sensor, found := getSensorByName(name)
+	if !found {
+		err = errors.New(fmt.Sprintf("unknown sensor '%s'", name))
+		return
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return
+	}
+	lastVal, err := getSensorNestedValue(sensor)
+	if err != nil {
+		return
+	}
+	return exprValueOf(TDataType(dataType), lastVal)
+}
+
+// getSensorExprValueAt : last recorded value of named sensor at t, converted for expression evaluation
+func getSensorExprValueAt(name string, t time.Time) (val interface{}, err error) {
+	sensor, found := getSensorByName(name)
+	if !found {
+		err = errors.New(fmt.Sprintf("unknown sensor '%s'", name))
+		return
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return
+	}
+	value, found, err := getHistoSensorAt(nil, sensor.getId(), t)
+	if err != nil {
+		return
+	}
+	if !found {
+		err = errors.New(fmt.Sprintf("no value for sensor '%s' at %v", name, t))
+		return
+	}
+	return exprValueOf(TDataType(dataType), value.Val)
+}
+
+// sensorUpdateWatches : rebuild the list of sensors watched by master sensor linked sensorAct
+func sensorUpdateWatches(sensor HomeObject) {
+	masterId := sensor.getId()
+
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		glog.Errorf("sensorUpdateWatches %d : %s", masterId, err)
+	}
+
+	// Compile conditions before locking, compilation use sensorRegistry
+	watches := map[int][]sensorActWatch{}
+	for _, sensorAct := range sensor.linkedObjs {
+		var refs []int
+		if prog, err := compileSensorActCondition(sensorAct, TDataType(dataType)); err != nil {
+			glog.Errorf("sensorUpdateWatches : sensorAct #%d condition : %s", sensorAct.getId(), err)
+		} else if prog != nil {
+			refs = append(refs, prog.sensorRefs...)
+		}
+		if prog, err := compileSensorActReset(sensorAct, TDataType(dataType)); err != nil {
+			glog.Errorf("sensorUpdateWatches : sensorAct #%d reset condition : %s", sensorAct.getId(), err)
+		} else if prog != nil {
+			refs = append(refs, prog.sensorRefs...)
+		}
+		seen := map[int]bool{masterId: true}
+		for _, refId := range refs {
+			if seen[refId] {
+				continue
+			}
+			seen[refId] = true
+			watches[refId] = append(watches[refId], sensorActWatch{sensorAct, masterId})
+		}
+	}
+
+	sensorActWatchesLock.Lock()
+	defer sensorActWatchesLock.Unlock()
+
+	// Remove previous watches for this master
+	for refId, list := range sensorActWatches {
+		kept := list[:0]
+		for _, w := range list {
+			if w.masterId != masterId {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) > 0 {
+			sensorActWatches[refId] = kept
+		} else {
+			delete(sensorActWatches, refId)
+		}
+	}
+
+	for refId, list := range watches {
+		sensorActWatches[refId] = append(sensorActWatches[refId], list...)
+	}
+}
+
+// sensorUpdateTicker : update sensor in-memory data then (re)start its ticker if sensor is active
 func sensorUpdateTicker(sensor HomeObject) (err error) {
+	sensorRegister(sensor)
+	sensorUpdateWatches(sensor)
+	sensorUpdateFormulaWatches(sensor)
+
 	sensorTickersLock.Lock()
 	defer sensorTickersLock.Unlock()
 
@@ -77,11 +272,43 @@ func sensorUpdateTicker(sensor HomeObject) (err error) {
 		ticker.Stop()
 		delete(sensorTickers, sensor.Values[0].IdObject)
 	}
+	// Sensor updated : driver state must be reset
+	CloseObjDriver(SensorFunc, sensor.Values[0].IdObject)
 
 	isActive, err := sensor.getIntVal("IsActive")
 	if err != nil || isActive == 0 {
 		return
 	}
+	sensorHealthReset(sensor.Values[0].IdObject)
+
+	// FileWatch sensor : values come from the followed file, no Interval / Schedule
+	if isFileWatchSensor(sensor) {
+		watcher, err := newFileWatcher(sensor)
+		if err != nil {
+			glog.Errorf("Failed to watch file for sensor %d : %s", sensor.Values[0].IdObject, err)
+			return err
+		}
+		sensorTickers[sensor.Values[0].IdObject] = watcher
+		return nil
+	}
+
+	// Schedule (crontab like) take precedence over Interval
+	schedule := strings.TrimSpace(sensor.getOptStrVal("Schedule", ""))
+	if len(schedule) > 0 {
+		sched, err := parseCronSchedule(schedule)
+		if err != nil {
+			glog.Errorf("Failed to parse schedule (%s) : %s", schedule, err)
+			return err
+		}
+
+		if glog.V(2) {
+			glog.Infof("Sensor %d (nb act=%d) : Schedule(%s)", sensor.Values[0].IdObject, len(sensor.linkedObjs), schedule)
+		}
+
+		sensorTickers[sensor.Values[0].IdObject] = newSensorJob(sensor, sched, 0)
+
+		return nil
+	}
 
 	durationStr, err := sensor.getStrVal("Interval")
 	if err != nil {
@@ -103,9 +330,7 @@ func sensorUpdateTicker(sensor HomeObject) (err error) {
 		glog.Infof("Sensor %d (nb act=%d) : Ticker(%v)", sensor.Values[0].IdObject, len(sensor.linkedObjs), duration)
 	}
 
-	sensorTickers[sensor.Values[0].IdObject] = time.NewTicker(duration)
-
-	go readSensor(sensor, sensorTickers[sensor.Values[0].IdObject])
+	sensorTickers[sensor.Values[0].IdObject] = newSensorJob(sensor, nil, duration)
 
 	return
 }
@@ -123,8 +348,8 @@ func sensorCleanup() {
 	}
 }
 
-// readSensorValue : perform sensor readings
-func readSensorValue(sensor HomeObject) (result string, err error) {
+// readSensorValue : perform sensor readings, reading is cancelled when ctx is done
+func readSensorValue(ctx context.Context, sensor HomeObject) (result string, err error) {
 	readCmd, err := sensor.getStrVal("ReadCmd")
 	if err != nil {
 		return
@@ -139,9 +364,18 @@ func readSensorValue(sensor HomeObject) (result string, err error) {
 	}
 
 	if isInternal != 0 {
-		result, err = CallInternalFunc(SensorFunc, readCmd, readParam, "")
+		result, err = CallObjFunc(ctx, SensorFunc, readCmd, sensor, readParam, "")
 	} else {
-		result, err = ExecExternalCmd(readCmd, readParam, "")
+		result, err = ExecExternalCmdContext(ctx, readCmd, readParam, "")
+	}
+	if err != nil {
+		return
+	}
+
+	// Apply sensor transform if any, a transform error is a read failure
+	if result, err = transformSensorValue(sensor, result); err != nil {
+		err = errors.New(fmt.Sprintf("sensor %d : %s", sensor.Values[0].IdObject, err))
+		return
 	}
 
 	if glog.V(2) {
@@ -160,256 +394,301 @@ func getSensorLastValue(sensor HomeObject) (result string, err error) {
 		if glog.V(2) {
 			glog.Infof("getSensorLastValue no prev val for %d, reading sensor", sensor.Values[0].IdObject)
 		}
-		result, err = readSensorValue(sensor)
+		result, err = readSensorWithWorker(context.Background(), sensor)
 	}
 	return
 }
 
-// readSensor : call readSensorValue according to corresponding ticker and handleSensorValue
-func readSensor(sensor HomeObject, ticker *time.Ticker) {
-	for t := range ticker.C {
-		result, err := readSensorValue(sensor)
-		if err != nil {
-			glog.Errorf("readSensor fail %s ", err)
-			continue
+// getSensorNestedValue : prev sensor value if any, else read sensor without worker
+// Used by expressions, evaluated while a worker is held (computed sensor read, sensor job handling its value) :
+// waiting for a second worker could block all workers until their timeout
+func getSensorNestedValue(sensor HomeObject) (result string, err error) {
+	sensorPrevValLock.Lock()
+	result, found := sensorPrevVal[sensor.Values[0].IdObject]
+	sensorPrevValLock.Unlock()
+	if !found {
+		if glog.V(2) {
+			glog.Infof("getSensorNestedValue no prev val for %d, reading sensor", sensor.Values[0].IdObject)
 		}
-		handleSensorValue(t, sensor, result)
+		ctx, cancel := context.WithTimeout(context.Background(), getSensorTimeout(sensor))
+		defer cancel()
+		result, err = readSensorValue(ctx, sensor)
 	}
+	return
 }
 
 // handleSensorValue : trigger actor and store sensor value in DB
 func handleSensorValue(t time.Time, sensor HomeObject, value string) {
-	sensorName, err := sensor.getStrVal("Name")
-	if err != nil {
-		return
-	}
-	record, err := sensor.getIntVal("Record")
-	if err != nil {
-		return
-	}
+	value = normaliseSensorValue(sensor, value)
+	sensorHealthOk(sensor)
 
 	// Previous value
 	sensorPrevValLock.Lock()
 	prevVal, found := sensorPrevVal[sensor.Values[0].IdObject]
+	if found && t.Unix() < sensorPrevTs[sensor.Values[0].IdObject].Unix() {
+		// Reading older than the last value (i.e. back-dated reading sent by a client) : only recorded
+		sensorPrevValLock.Unlock()
+		recordOldSensorValue(t, sensor, value)
+		return
+	}
 	if !found {
-		prevVal = value // TODO get prev val from db ?
+		prevVal = value // No value in HistoSensor at startup
 	}
 	sensorPrevVal[sensor.Values[0].IdObject] = value
+	sensorPrevTs[sensor.Values[0].IdObject] = t
 	sensorPrevValLock.Unlock()
 
-	// Record value if required
-	if record != 0 { // TODO add more options : 0=never, 1=always, 2=only if change, ...
+	// Record value if required by sensor record policy
+	if checkRecordPolicy(t, sensor, value) {
 		go recordSensorValue(t, sensor, value)
+	} else if sensor.getOptIntVal("KeepLastVal", 0) != 0 &&
+		TRecordMode(sensor.getOptIntVal("Record", 0)) == RecordNever &&
+		(!found || prevVal != value) {
+		// Not recording, but keep last value to restore it at startup (not async : values must be kept in order)
+		keepSensorLastValue(t, sensor, value)
 	}
 	// Trigger linked sensorAct if any
 	for _, sensorAct := range sensor.linkedObjs {
-		go triggerSensorAct(sensorAct, sensorName, prevVal, value)
+		go triggerSensorAct(sensorAct, sensor, prevVal, value)
+	}
+	// Value changed : update computed sensors and trigger sensorAct of other sensors referencing this one
+	if !found || prevVal != value {
+		updateComputedSensors(sensor.getId())
+		triggerWatchingSensorAct(sensor.getId())
 	}
 }
 
-// recordSensorValue : store in DB a value for a given sensor reading
-func recordSensorValue(t time.Time, sensor HomeObject, value string) {
-	db, err := openDB()
-	if err != nil {
+// triggerWatchingSensorAct : re-evaluate sensorAct watching sensorId, using their master sensor last value (as prev and last value)
+func triggerWatchingSensorAct(sensorId int) {
+	sensorActWatchesLock.Lock()
+	watches := append([]sensorActWatch(nil), sensorActWatches[sensorId]...)
+	sensorActWatchesLock.Unlock()
+
+	for _, w := range watches {
+		sensorRegistryLock.Lock()
+		master, found := sensorRegistry[w.masterId]
+		sensorRegistryLock.Unlock()
+		if !found {
+			continue
+		}
+		go func(sensorAct HomeObject, master HomeObject) {
+			masterVal, err := getSensorLastValue(master)
+			if err != nil {
+				glog.Errorf("triggerWatchingSensorAct : sensor %d read fail : %s", master.getId(), err)
+				return
+			}
+			triggerSensorAct(sensorAct, master, masterVal, masterVal)
+		}(w.sensorAct, master)
+	}
+}
+
+// checkSensorSchedule : check sensor schedule (if any) is a valid crontab like schedule
+func checkSensorSchedule(sensor HomeObject) (err error) {
+	schedule := strings.TrimSpace(sensor.getOptStrVal("Schedule", ""))
+	if len(schedule) <= 0 {
 		return
 	}
-	defer db.Close()
+	_, err = parseCronSchedule(schedule)
+	return
+}
 
-	sensorId := sensor.getId()
+// checkSensorTransform : check sensor transform (if any) is valid
+func checkSensorTransform(sensor HomeObject) (err error) {
+	_, err = compileTransform(sensor.getOptStrVal("Transform", ""))
+	return
+}
+
+// transformSensorValue : apply sensor transform (if any) to a raw sensor value
+func transformSensorValue(sensor HomeObject, value string) (result string, err error) {
+	steps, err := compileTransform(sensor.getOptStrVal("Transform", ""))
+	if err != nil || len(steps) <= 0 {
+		return value, err
+	}
+	return applyTransform(steps, value)
+}
+
+// checkSensorValue : check value is valid for sensor data type
+func checkSensorValue(sensor HomeObject, value string) (err error) {
 	dataType, err := sensor.getIntVal("IdDataType")
 	if err != nil {
 		return
 	}
-
-	// check value regarding datatype
+	value = strings.TrimSpace(value)
 	switch TDataType(dataType) {
-	case DBTypeBool, DBTypeInt, DBTypeDateTime:
-		_, err := strconv.Atoi(value)
-		if err != nil {
-			glog.Errorf("Fail to get int(%s) for sensor %d : %s", value, sensorId, err)
-			return
-		}
-	case DBTypeText:
+	case DBTypeBool:
+		_, err = strconv.ParseBool(value)
+	case DBTypeInt, DBTypeDateTime:
+		_, err = strconv.ParseInt(value, 10, 64)
 	case DBTypeFloat:
-		_, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			glog.Errorf("Fail to get float64(%s) for sensor %d : %s", value, sensorId, err)
-			return
+		_, err = strconv.ParseFloat(value, 64)
+	case DBTypeText:
+	case DBTypeJSON:
+		var doc interface{}
+		if err = json.Unmarshal([]byte(value), &doc); err == nil {
+			if _, isObj := doc.(map[string]interface{}); !isObj {
+				err = errors.New("not a json object")
+			}
 		}
 	default:
-		glog.Errorf("Unknown data type %d for sensor %d", dataType, sensorId)
-		return
+		err = errors.New(fmt.Sprintf("Unknown data type %d", dataType))
 	}
-
-	_, err = db.Exec("insert into HistoSensor values ( ?, ?, ?);", t.Unix(), sensorId, value)
 	if err != nil {
-		glog.Errorf("Fail to store %d value (%s) for sensor %d : %s ", dataType, value, sensorId, err)
-	}
-	if glog.V(2) {
-		sensorName, _ := sensor.getStrVal("Name")
-		glog.Infof("recordSensorValue for %s (%s)", sensorName, value)
+		err = errors.New(fmt.Sprintf("Bad value '%s' for sensor %d : %s", value, sensor.getId(), err))
 	}
+	return
 }
 
-// triggerSensorAct
-func triggerSensorAct(sensorAct HomeObject, sensorName string, prevVal string, lastVal string) {
-	sensorActId := sensorAct.getId()
-
-	// Check IsActive
-	isActive, err := sensorAct.getStrVal("IsActive")
-	if err != nil || isActive != "1" {
-		return
+// normaliseSensorValue : bool values are stored as 1 / 0 (so they can be summarized, see histo.go)
+func normaliseSensorValue(sensor HomeObject, value string) string {
+	if TDataType(sensor.getOptIntVal("IdDataType", 0)) != DBTypeBool {
+		return value
 	}
-
-	// Prepare condition
-	condition, err := sensorAct.getStrVal("Condition")
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
 	if err != nil {
-		return
+		return value
 	}
-	condition = strings.TrimSpace(condition)
-	condition = strings.Replace(condition, TagSensorName, sensorName, -1)
-	condition = strings.Replace(condition, TagPrevVal, cleanSpaces(prevVal), -1)
-	condition = strings.Replace(condition, TagLastVal, cleanSpaces(lastVal), -1)
-	if glog.V(2) {
-		glog.Infof("Condition for sensorAct #%d (%s) = '%s'", sensorActId, sensorName, condition)
+	return exprFormat(b)
+}
+
+// checkRecordPolicy : return true if value must be recorded according to sensor record policy
+// If so, value is kept as the last recorded value for the sensor
+func checkRecordPolicy(t time.Time, sensor HomeObject, value string) bool {
+	sensorId := sensor.getId()
+	mode, err := sensor.getIntVal("Record")
+	if err != nil {
+		return false
 	}
 
-	launchAct := false
-	if len(condition) <= 0 {
-		launchAct = true
-	} else {
-		// Eval condition
-		tv, err := types.Eval(token.NewFileSet(), nil, token.NoPos, condition)
-		if err != nil {
-			glog.Errorf("Fail to eval condition for sensorAct #%d (%s) '%s' : %s", sensorActId, sensorName, condition, err)
-		} else {
-			if tv.Value != nil {
-				launchAct = constant.BoolVal(tv.Value)
-			}
+	sensorLastRecLock.Lock()
+	defer sensorLastRecLock.Unlock()
+
+	lastRec, found := sensorLastRec[sensorId]
+
+	record := false
+	switch TRecordMode(mode) {
+	case RecordNever:
+		return false
+	case RecordAlways:
+		record = true
+	case RecordOnChange:
+		record = !found || value != lastRec.Val
+	case RecordDeadband:
+		if !found {
+			record = true
+			break
 		}
-	}
-	if launchAct {
-		// Prepare actorParam
-		actorParam, err := sensorAct.getStrVal("ActorParam")
+		delta, err := strconv.ParseFloat(sensor.getOptStrVal("RecordDelta", "0"), 64)
 		if err != nil {
-			actorParam = lastVal
+			glog.Errorf("Bad RecordDelta for sensor %d : %s", sensorId, err)
+			delta = 0
+		}
+		newVal, err1 := strconv.ParseFloat(value, 64)
+		oldVal, err2 := strconv.ParseFloat(lastRec.Val, 64)
+		if err1 != nil || err2 != nil || delta <= 0 {
+			record = value != lastRec.Val
 		} else {
-			actorParam = strings.Replace(actorParam, TagSensorName, sensorName, -1)
-			actorParam = strings.Replace(actorParam, TagPrevVal, prevVal, -1)
-			actorParam = strings.Replace(actorParam, TagLastVal, lastVal, -1)
-			actorParam = strings.Replace(actorParam, TagCondition, condition, -1)
-			actorParam = cleanSpaces(actorParam)
+			record = math.Abs(newVal-oldVal) >= delta
 		}
-
-		actorId, err := sensorAct.getIntVal("idActor")
-		if err != nil {
-			return
+	case RecordSampled:
+		if !found || value != lastRec.Val {
+			record = true
+			break
 		}
-
-		if glog.V(1) {
-			glog.Infof("triggerSensorAct : launching Actor #%d", actorId)
+		interval, err := time.ParseDuration(sensor.getOptStrVal("RecordInterval", "0s"))
+		if err != nil {
+			glog.Errorf("Bad RecordInterval for sensor %d : %s", sensorId, err)
+			break
 		}
-
-		triggerActorById(actorId, 1, actorParam)
+		record = interval > 0 && t.Sub(lastRec.Ts) >= interval
+	default:
+		glog.Errorf("Unknown record mode %d for sensor %d", mode, sensorId)
+		return false
 	}
 
+	if record {
+		sensorLastRec[sensorId] = HistoSensor{t, sensorId, value}
+	}
+	if glog.V(3) {
+		glog.Infof("checkRecordPolicy sensor %d mode %d (%s) => %v", sensorId, mode, value, record)
+	}
+	return record
 }
 
-// -----------------------------------------------
-// -----------------------------------------------
-
-var cpuReadNs int64
-var cpuReadVal int
-
-func readProcStat() (nano int64, read int, nb int, err error) {
-	nano = time.Now().UnixNano()
-	f, err := os.Open("/proc/stat")
+// recordSensorValue : store in DB a value for a given sensor reading
+func recordSensorValue(t time.Time, sensor HomeObject, value string) {
+	db, err := openDB()
 	if err != nil {
-		glog.Errorf("CpuUsage : %s", err)
 		return
 	}
-	defer f.Close()
-
-	var key string
-	var u, n, s int
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		_, err = fmt.Sscanf(line, "%s %d %d %d", &key, &u, &n, &s)
-		if err != nil {
-			glog.Errorf("Scan fail '%s' : %s", line, err)
-			return
-		}
-		if key == "cpu" {
-			read = u + n + s
-		} else if strings.HasPrefix(key, "cpu") {
-			nb++
-		} else {
-			break
-		}
-	}
-	return
-}
+	defer db.Close()
 
-func CpuUsage(param1 string, param2 string) (string, error) {
-	nano, read, nb, err := readProcStat()
+	sensorId := sensor.getId()
+	dataType, err := sensor.getIntVal("IdDataType")
 	if err != nil {
-		return "99", err
+		return
 	}
 
-	// If previous mesure was more than 60s ago
-	if nano-cpuReadNs > 60000000 {
-		cpuReadNs = nano
-		cpuReadVal = read
-		time.Sleep(time.Second)
-		nano, read, nb, err = readProcStat()
-		if err != nil {
-			return "99", err
-		}
+	// check value regarding datatype
+	if err = checkSensorValue(sensor, value); err != nil {
+		glog.Error(err)
+		return
 	}
 
-	load := float32(int64(read-cpuReadVal)*1000000000.0) / float32((nano-cpuReadNs)*int64(nb)*1.0)
-	load += 0.5 // for rounding when converting with %.0f
+	// a value older than the current 5m bucket may belong to rolled up buckets (see histo.go)
+	late := isRollupDataType(sensor) && t.Before(histoBucketStart(time.Now(), histoRollupRes[0]))
+	if late {
+		histoRollupLock.Lock()
+		defer histoRollupLock.Unlock()
+	}
 
-	if glog.V(1) {
-		glog.Infof("CpuUsage %3.2f = %d / ( %d * %d )", load, (read-cpuReadVal)*1000000000, nano-cpuReadNs, nb)
+	_, err = db.Exec("insert into HistoSensor values ( ?, ?, ?);", t.Unix(), sensorId, value)
+	if err != nil {
+		glog.Errorf("Fail to store %d value (%s) for sensor %d : %s ", dataType, value, sensorId, err)
+		return
+	}
+	if late {
+		rollupLateValue(db, sensor, t, value)
+	}
+	if glog.V(2) {
+		sensorName, _ := sensor.getStrVal("Name")
+		glog.Infof("recordSensorValue for %s (%s)", sensorName, value)
 	}
+}
 
-	return fmt.Sprintf("%.0f", load), nil
+// recordOldSensorValue : store in DB a reading older than the sensor last value, unless sensor never records
+// Record policy state is left untouched (an old reading is not the last recorded value)
+func recordOldSensorValue(t time.Time, sensor HomeObject, value string) {
+	if TRecordMode(sensor.getOptIntVal("Record", 0)) == RecordNever {
+		return
+	}
+	if glog.V(2) {
+		glog.Infof("recordOldSensorValue for %d : %s (%v)", sensor.getId(), value, t)
+	}
+	recordSensorValue(t, sensor, value)
 }
 
-func MemoryUsage(param1 string, param2 string) (string, error) {
-	f, err := os.Open("/proc/meminfo")
+// keepSensorLastValue : store in SensorLastVal the last value of a sensor not recording its values
+// HistoSensor is left untouched. An older value (i.e. written late) does not replace a newer one
+func keepSensorLastValue(t time.Time, sensor HomeObject, value string) {
+	db, err := openDB()
 	if err != nil {
-		glog.Errorf("CpuUsage : %s", err)
-		return "99", err
+		return
 	}
-	defer f.Close()
+	defer db.Close()
 
-	var key string
-	var val, total, free int
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		_, err = fmt.Sscanf(line, "%s %d", &key, &val)
-		if err != nil {
-			glog.Errorf("Scan fail '%s' : %s", line, err)
-			return "99", err
-		}
-		if key == "MemTotal:" {
-			total = val
-		} else if key == "MemFree:" {
-			free = val
-		} else {
-			break
-		}
+	sensorId := sensor.getId()
+	if err = checkSensorValue(sensor, value); err != nil {
+		glog.Error(err)
+		return
 	}
 
-	used := float32((total-free)*100) / float32(total)
-
-	if glog.V(1) {
-		glog.Infof("MemoryUsage %3.2f = %d / %d", used, total, free)
+	_, err = db.Exec("insert into SensorLastVal values ( ?, ?, ?) on conflict(idObject) do update set ts = excluded.ts, Val = excluded.Val where excluded.ts >= SensorLastVal.ts;",
+		sensorId, t.Unix(), value)
+	if err != nil {
+		glog.Errorf("Fail to keep last value (%s) for sensor %d : %s ", value, sensorId, err)
+		return
+	}
+	if glog.V(2) {
+		glog.Infof("keepSensorLastValue for %d (%s)", sensorId, value)
 	}
-
-	return fmt.Sprintf("%.0f", used), nil
 }
@@ -0,0 +1,434 @@
+// sensoract.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+
+// Tags available in SensorAct ActorParam
+const (
+	TagSensorName = "@sensorName@"
+	TagPrevVal    = "@prevVal@"
+	TagLastVal    = "@lastVal@"
+	TagCondition  = "@condition@"
+	TagLastError  = "@lastError@" // Stale / Recovered event only
+)
+
+// Variables available in SensorAct Condition (used as @name@)
+const (
+	VarSensorName = "sensorName"
+	VarPrevVal    = "prevVal"
+	VarLastVal    = "lastVal"
+)
+
+// -----------------------------------------------
+
+// sensorActState : trigger state of a sensorAct (debounce, hysteresis and cooldown)
+type sensorActState struct {
+	IdObject    int       // sensorAct id
+	Armed       bool      // false after a trigger until 'ResetCondition' is true
+	HoldCount   int       // nb of consecutive readings with condition true
+	HoldSince   time.Time // condition true since (zero if condition false)
+	LastEval    time.Time
+	LastResult  bool // last condition result
+	LastTrigger time.Time
+	Suppressed  int // nb of readings with condition true but no trigger since LastTrigger
+}
+
+var sensorActStatesLock sync.Mutex
+var sensorActStates = map[int]*sensorActState{}
+
+// -----------------------------------------------
+
+// compileSensorActExpr : compile a sensorAct bool expression for a master sensor returning dataType values
+// Return a nil program for an empty expression
+func compileSensorActExpr(src string, dataType TDataType) (prog *exprProgram, err error) {
+	src = strings.TrimSpace(src)
+	if len(src) <= 0 {
+		return
+	}
+
+	vars := map[string]exprType{
+		VarSensorName: exprString,
+		VarPrevVal:    exprTypeOf(dataType),
+		VarLastVal:    exprTypeOf(dataType),
+	}
+	if dataType == DBTypeJSON {
+		// @lastVal.path@ and @prevVal.path@ for sub-fields, typed at eval time
+		vars[VarPrevVal+".*"] = exprAny
+		vars[VarLastVal+".*"] = exprAny
+	}
+
+	prog, err = exprCompile(src, vars)
+	if err != nil {
+		return
+	}
+	prog.root = exprAs(prog.root, exprBool)
+	if prog.Type() != exprBool {
+		err = errors.New(fmt.Sprintf("must be a bool expression, not %s", prog.Type()))
+		prog = nil
+	}
+	return
+}
+
+// compileSensorActCondition : compile sensorAct condition for a master sensor returning dataType values
+// Return a nil program for an empty condition (always true)
+func compileSensorActCondition(sensorAct HomeObject, dataType TDataType) (prog *exprProgram, err error) {
+	condition, err := sensorAct.getStrVal("Condition")
+	if err != nil {
+		return
+	}
+	return compileSensorActExpr(condition, dataType)
+}
+
+// compileSensorActReset : compile sensorAct reset condition
+// Return a nil program for an empty reset condition (sensorAct always armed)
+func compileSensorActReset(sensorAct HomeObject, dataType TDataType) (prog *exprProgram, err error) {
+	return compileSensorActExpr(sensorAct.getOptStrVal("ResetCondition", ""), dataType)
+}
+
+// getSensorActDuration : read optional duration field of sensorAct (0 if empty)
+func getSensorActDuration(sensorAct HomeObject, fieldName string) (duration time.Duration, err error) {
+	durationStr := strings.TrimSpace(sensorAct.getOptStrVal(fieldName, ""))
+	if len(durationStr) <= 0 {
+		return
+	}
+	duration, err = time.ParseDuration(durationStr)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("bad %s '%s' : %s", fieldName, durationStr, err))
+	}
+	return
+}
+
+// checkSensorActCondition : check sensorAct condition compiles for its master sensor
+func checkSensorActCondition(sensorAct HomeObject) error {
+	masterId, err := sensorAct.getIntVal("idMasterObj")
+	if err != nil {
+		return err
+	}
+	sensors, err := getHomeObjects(nil, ItemIdNone, masterId)
+	if err != nil {
+		return err
+	}
+	if len(sensors) <= 0 {
+		return errors.New(fmt.Sprintf("Master sensor %d not found", masterId))
+	}
+	dataType, err := sensors[0].getIntVal("IdDataType")
+	if err != nil {
+		return err
+	}
+	if _, err = compileSensorActCondition(sensorAct, TDataType(dataType)); err != nil {
+		return errors.New(fmt.Sprintf("Condition error : %s", err))
+	}
+	if _, err = compileSensorActReset(sensorAct, TDataType(dataType)); err != nil {
+		return errors.New(fmt.Sprintf("ResetCondition error : %s", err))
+	}
+	for _, fieldName := range []string{"MinInterval", "HoldDuration"} {
+		if _, err = getSensorActDuration(sensorAct, fieldName); err != nil {
+			return err
+		}
+	}
+	if sensorAct.getOptIntVal("HoldCount", 0) < 0 {
+		return errors.New("HoldCount must be >= 0")
+	}
+	switch TSensorEvent(sensorAct.getOptIntVal("Event", 0)) {
+	case SensorEventValue, SensorEventStale, SensorEventRecovered:
+	default:
+		return errors.New(fmt.Sprintf("Bad Event %d", sensorAct.getOptIntVal("Event", 0)))
+	}
+	return nil
+}
+
+// expandSensorActTags : replace sensorAct tags in text
+func expandSensorActTags(text string, sensorName string, prevVal string, lastVal string) string {
+	text = strings.Replace(text, TagSensorName, sensorName, -1)
+	text = strings.Replace(text, TagPrevVal, prevVal, -1)
+	text = strings.Replace(text, TagLastVal, lastVal, -1)
+	return text
+}
+
+// sensorActEnv : expression environment for master sensor values
+// An empty value of a non text sensor is no value (i.e. Stale event of a sensor never read) : the variable
+// is not set, so only a condition using it fails
+func sensorActEnv(sensorName string, dataType TDataType, prevVal string, lastVal string, now time.Time) (env exprEnv, err error) {
+	env = exprEnv{now: now, vars: map[string]interface{}{VarSensorName: sensorName}}
+	noValue := func(val string) bool {
+		return exprTypeOf(dataType) != exprString && len(strings.TrimSpace(val)) <= 0
+	}
+	if !noValue(prevVal) {
+		if env.vars[VarPrevVal], err = exprValueOf(dataType, prevVal); err != nil {
+			err = errors.New(fmt.Sprintf("bad prevVal '%s' : %s", prevVal, err))
+			return
+		}
+	}
+	if !noValue(lastVal) {
+		if env.vars[VarLastVal], err = exprValueOf(dataType, lastVal); err != nil {
+			err = errors.New(fmt.Sprintf("bad lastVal '%s' : %s", lastVal, err))
+		}
+	}
+	return
+}
+
+// evalSensorAct : eval sensorAct condition for master sensor values
+// Return condition result and the actor parameter to use if condition is true
+// On replay, other sensors values are read at time now from HistoSensor
+func evalSensorAct(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string, now time.Time, replay bool) (launchAct bool, actorParam string, err error) {
+	sensorName, err := sensor.getStrVal("Name")
+	if err != nil {
+		return
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return
+	}
+
+	prog, err := compileSensorActCondition(sensorAct, TDataType(dataType))
+	if err != nil {
+		return
+	}
+
+	launchAct = true
+	condition := ""
+	if prog != nil {
+		var env exprEnv
+		if env, err = sensorActEnv(sensorName, TDataType(dataType), prevVal, lastVal, now); err != nil {
+			return
+		}
+		env.replay = replay
+		if launchAct, err = prog.EvalBool(env); err != nil {
+			return
+		}
+		condition = expandSensorActTags(prog.src, sensorName, cleanSpaces(prevVal), cleanSpaces(lastVal))
+	}
+
+	actorParam = sensorActParam(sensorAct, sensorName, prevVal, lastVal, condition)
+
+	if glog.V(2) {
+		glog.Infof("Condition for sensorAct #%d (%s) = '%s' => %v", sensorAct.getId(), sensorName, condition, launchAct)
+	}
+	return
+}
+
+// sensorActParam : sensorAct actor parameter with tags replaced (lastVal if sensorAct has no ActorParam)
+func sensorActParam(sensorAct HomeObject, sensorName string, prevVal string, lastVal string, condition string) string {
+	if !sensorAct.hasField("ActorParam") {
+		return lastVal
+	}
+	actorParam := expandSensorActTags(sensorAct.getOptStrVal("ActorParam", ""), sensorName, prevVal, lastVal)
+	actorParam = strings.Replace(actorParam, TagCondition, condition, -1)
+	return cleanSpaces(actorParam)
+}
+
+// SensorActDryRun : sensorAct evaluation for given master sensor values (no state change, no actor called)
+type SensorActDryRun struct {
+	Condition      string // condition with tags replaced
+	Result         bool   // condition result (true if no condition)
+	Error          string // condition compile or eval error
+	ResetCondition string // reset condition with tags replaced
+	ResetResult    bool
+	ResetError     string
+	ActorParam     string // actor parameter with tags replaced
+}
+
+// dryRunSensorAct : eval sensorAct condition, reset condition and actor parameter for master sensor values
+func dryRunSensorAct(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string, now time.Time) (res SensorActDryRun) {
+	sensorName := sensor.getOptStrVal("Name", "")
+	prev, last := cleanSpaces(prevVal), cleanSpaces(lastVal)
+	res.Condition = expandSensorActTags(strings.TrimSpace(sensorAct.getOptStrVal("Condition", "")), sensorName, prev, last)
+	res.ResetCondition = expandSensorActTags(strings.TrimSpace(sensorAct.getOptStrVal("ResetCondition", "")), sensorName, prev, last)
+
+	var err error
+	if res.Result, _, err = evalSensorAct(sensorAct, sensor, prevVal, lastVal, now, false); err != nil {
+		res.Result = false
+		res.Error = err.Error()
+	}
+	res.ActorParam = sensorActParam(sensorAct, sensorName, prevVal, lastVal, res.Condition)
+
+	if len(res.ResetCondition) > 0 {
+		if res.ResetResult, err = evalSensorActReset(sensorAct, sensor, prevVal, lastVal, now, false); err != nil {
+			res.ResetError = err.Error()
+		}
+	}
+	return
+}
+
+// triggerSensorAct : launch sensorAct actor if sensorAct condition is true for master sensor values
+// Only for sensorAct on new values (Event = Value)
+func triggerSensorAct(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string) {
+	if TSensorEvent(sensorAct.getOptIntVal("Event", 0)) != SensorEventValue {
+		return
+	}
+	launchSensorAct(sensorAct, sensor, prevVal, lastVal, "")
+}
+
+// triggerSensorEventAct : launch sensor linked sensorAct for a Stale / Recovered event, using sensor last value
+// (empty if sensor never returned a value)
+func triggerSensorEventAct(sensor HomeObject, event TSensorEvent) {
+	sensorPrevValLock.Lock()
+	lastVal := sensorPrevVal[sensor.getId()]
+	sensorPrevValLock.Unlock()
+	lastError := getSensorHealth(sensor.getId()).LastError
+
+	for _, sensorAct := range sensor.linkedObjs {
+		if TSensorEvent(sensorAct.getOptIntVal("Event", 0)) == event {
+			go launchSensorAct(sensorAct, sensor, lastVal, lastVal, lastError)
+		}
+	}
+}
+
+// launchSensorAct : launch sensorAct actor if sensorAct condition is true and trigger rules allow it
+func launchSensorAct(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string, lastError string) {
+	sensorActId := sensorAct.getId()
+
+	// Check IsActive
+	isActive, err := sensorAct.getStrVal("IsActive")
+	if err != nil || isActive != "1" {
+		return
+	}
+
+	now := time.Now()
+	launchAct, actorParam, err := evalSensorAct(sensorAct, sensor, prevVal, lastVal, now, false)
+	if err != nil {
+		glog.Errorf("Fail to eval condition for sensorAct #%d : %s", sensorActId, err)
+		return
+	}
+	actorParam = strings.Replace(actorParam, TagLastError, cleanSpaces(lastError), -1)
+	if !checkSensorActTrigger(sensorAct, sensor, prevVal, lastVal, launchAct, now) {
+		return
+	}
+
+	actorId, err := sensorAct.getIntVal("idActor")
+	if err != nil {
+		return
+	}
+
+	// Actor job not waited for : sensor readings are not delayed by actors
+	job, err := startActorJobById(actorId, 1, actorParam)
+	if err != nil {
+		return
+	}
+	if glog.V(1) {
+		glog.Infof("triggerSensorAct : launching Actor #%d (job #%d)", actorId, job.getState().JobId)
+	}
+}
+
+// evalSensorActReset : eval sensorAct reset condition for master sensor values
+// Return true if no reset condition is defined
+func evalSensorActReset(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string, now time.Time, replay bool) (reset bool, err error) {
+	sensorName, err := sensor.getStrVal("Name")
+	if err != nil {
+		return
+	}
+	dataType, err := sensor.getIntVal("IdDataType")
+	if err != nil {
+		return
+	}
+	prog, err := compileSensorActReset(sensorAct, TDataType(dataType))
+	if err != nil || prog == nil {
+		return err == nil, err
+	}
+	env, err := sensorActEnv(sensorName, TDataType(dataType), prevVal, lastVal, now)
+	if err != nil {
+		return
+	}
+	env.replay = replay
+	return prog.EvalBool(env)
+}
+
+// checkSensorActTrigger : update sensorAct state with condition result and return true if actor must be launched
+//   - HoldCount / HoldDuration : condition must be true for N consecutive readings / for a duration (debounce)
+//   - ResetCondition : once triggered, sensorAct is disarmed until reset condition is true (hysteresis)
+//   - MinInterval : min. duration between 2 triggers (cooldown)
+func checkSensorActTrigger(sensorAct HomeObject, sensor HomeObject, prevVal string, lastVal string, condition bool, now time.Time) bool {
+	sensorActId := sensorAct.getId()
+	hasReset := len(strings.TrimSpace(sensorAct.getOptStrVal("ResetCondition", ""))) > 0
+
+	state := getSensorActState(sensorActId)
+
+	// Eval reset condition only when disarmed
+	reset := false
+	if hasReset && !state.Armed {
+		var err error
+		if reset, err = evalSensorActReset(sensorAct, sensor, prevVal, lastVal, now, false); err != nil {
+			glog.Errorf("Fail to eval reset condition for sensorAct #%d : %s", sensorActId, err)
+		}
+	}
+
+	sensorActStatesLock.Lock()
+	defer sensorActStatesLock.Unlock()
+
+	st, found := sensorActStates[sensorActId]
+	if !found {
+		st = &sensorActState{IdObject: sensorActId, Armed: true}
+		sensorActStates[sensorActId] = st
+	}
+	return updateSensorActState(st, sensorAct, condition, reset, now)
+}
+
+// updateSensorActState : update st with condition (and reset condition) result, return true if actor must be launched
+func updateSensorActState(st *sensorActState, sensorAct HomeObject, condition bool, reset bool, now time.Time) bool {
+	sensorActId := sensorAct.getId()
+
+	minInterval, err := getSensorActDuration(sensorAct, "MinInterval")
+	if err != nil {
+		glog.Errorf("checkSensorActTrigger #%d : %s", sensorActId, err)
+	}
+	holdDuration, err := getSensorActDuration(sensorAct, "HoldDuration")
+	if err != nil {
+		glog.Errorf("checkSensorActTrigger #%d : %s", sensorActId, err)
+	}
+	holdCount := sensorAct.getOptIntVal("HoldCount", 0)
+	hasReset := len(strings.TrimSpace(sensorAct.getOptStrVal("ResetCondition", ""))) > 0
+
+	st.LastEval = now
+	st.LastResult = condition
+	if reset || !hasReset {
+		st.Armed = true
+	}
+
+	if !condition {
+		st.HoldCount = 0
+		st.HoldSince = time.Time{}
+		return false
+	}
+
+	st.HoldCount++
+	if st.HoldSince.IsZero() {
+		st.HoldSince = now
+	}
+	if st.HoldCount < holdCount || now.Sub(st.HoldSince) < holdDuration {
+		return false
+	}
+
+	if !st.Armed || (!st.LastTrigger.IsZero() && now.Sub(st.LastTrigger) < minInterval) {
+		st.Suppressed++
+		if glog.V(2) {
+			glog.Infof("checkSensorActTrigger #%d : trigger suppressed (armed=%v, last=%v, nb=%d)", sensorActId, st.Armed, st.LastTrigger, st.Suppressed)
+		}
+		return false
+	}
+
+	st.LastTrigger = now
+	st.Suppressed = 0
+	st.Armed = !hasReset
+	return true
+}
+
+// getSensorActState : return a copy of sensorAct current state
+func getSensorActState(sensorActId int) sensorActState {
+	sensorActStatesLock.Lock()
+	defer sensorActStatesLock.Unlock()
+	st, found := sensorActStates[sensorActId]
+	if !found {
+		return sensorActState{IdObject: sensorActId, Armed: true}
+	}
+	return *st
+}
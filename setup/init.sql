@@ -23,8 +23,13 @@ insert into ItemFieldVal values ( 0, 0, 'objectNone' );
 create table HistoSensor (ts datetime not null, idObject integer not null, Val text);
 create unique index HistoSensor_PK on HistoSensor (ts, idObject);
 
-create table HistoActor (ts datetime not null, idObject integer not null, idUser int not null, Param text, Res text);
-create unique index HistoActor_PK on HistoActor (ts, idObject, idUser);
+create table SensorLastVal (idObject integer not null primary key, ts datetime not null, Val text);
+
+create table HistoActor (ts datetime not null, idObject integer not null, idUser int not null, Param text, Res text, endTs datetime, duration integer, status text);
+create index HistoActor_IDX on HistoActor (ts, idObject, idUser);
+
+create table HistoRollup (idObject integer not null, resolution integer not null, ts datetime not null, minVal real, maxVal real, avgVal real, nbVal integer);
+create unique index HistoRollup_PK on HistoRollup (idObject, resolution, ts);
 
 create table RefValues (name text not null, code text not null, label text);
 create unique index RefValues_PK1 on RefValues (name, code);
@@ -50,6 +55,12 @@ insert into goHome values    ( 'Backup', 'files_3',         '/usr/bin/rsync -axv
 insert into goHome values    ( 'Backup', 'archive',         '/bin/tar cvfah @archiveName@ -C @backupDir@ .');
 insert into goHome values    ( 'Backup', 'externalize',     '/usr/bin/curl -s --disable-epsv -T"@archiveName@" -u"$USERNAME:$PASSWORD" "ftp://$SERVER$DESTDIR/"');
 insert into goHome values    ( 'Backup', 'cleanup',         '/bin/rm -f @archiveName@');
+-- History parameters : rollup/purge job schedule and retention in days (0 = keep forever)
+insert into goHome values    ( 'History', 'schedule',       '*/5');
+insert into goHome values    ( 'History', 'retention_5m',   '60');
+insert into goHome values    ( 'History', 'retention_1h',   '730');
+insert into goHome values    ( 'History', 'retention_1d',   '0');
+insert into goHome values    ( 'History', 'retention_actor', '365');
 -- UPnP parameters to allow access to the server if behind a router with NAT (UPnP must be enable on the router) -- update with desire port number
 insert into goHome select 'UPnP', '8080', '@localhost@:' || gp.val from goHome gp where gp.perimeter = 'Http' and gp.name = 'https_port';
 insert into goHome select 'UPnP', '8079', '@localhost@:' || gp.val from goHome gp where gp.perimeter = 'Http' and gp.name = 'simple_port';
@@ -75,12 +86,23 @@ insert into RefValues values ('YN', '1', 'Yes');
 -- UserProfil
 insert into RefValues values ('UserProfil', '1', 'Administrator');
 insert into RefValues values ('UserProfil', '2', 'User');
--- DataType / ajouter un type JSON ?
+-- DataType (6 is reserved for URL in www)
 insert into RefValues values ('DataType', '1', 'Bool');
 insert into RefValues values ('DataType', '2', 'Int');
 insert into RefValues values ('DataType', '3', 'Float');
 insert into RefValues values ('DataType', '4', 'Text');
 insert into RefValues values ('DataType', '5', 'DateTime');
+insert into RefValues values ('DataType', '7', 'JSON');
+-- RecordT : sensor record policy
+insert into RefValues values ('RecordT', '0', 'Never');
+insert into RefValues values ('RecordT', '1', 'Always');
+insert into RefValues values ('RecordT', '2', 'On change');
+insert into RefValues values ('RecordT', '3', 'Deadband');
+insert into RefValues values ('RecordT', '4', 'Sampled');
+-- SensorEventT : sensorAct trigger event
+insert into RefValues values ('SensorEventT', '0', 'Value');
+insert into RefValues values ('SensorEventT', '1', 'Stale');
+insert into RefValues values ('SensorEventT', '2', 'Recovered');
 -- ImgSensorT
 insert into RefValues values ('ImgSensorT', '1', 'USB');
 insert into RefValues values ('ImgSensorT', '2', 'URL');
@@ -106,6 +128,8 @@ insert into RefValues values ('url', '-1', '^[a-zA-Z0-9.\-_/:]*$');
 insert into RefValues values ('tel', '-1', '^[0-9]*$');
 -- duration
 insert into RefValues values ('Duration', '-1', '^[0-9]+(h|m|s|ms)$');
+-- date time (YYYY-MM-DD hh:mm)
+insert into RefValues values ('DateTime', '-1', '^[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}$');
 
 
 insert into Item values ( 1, 'User',         1, 0, '' );
@@ -113,6 +137,8 @@ insert into Item values ( 2, 'Sensor',       1, 0, '' );
 insert into Item values ( 3, 'Actor',        1, 0, '' );
 insert into Item values ( 4, 'SensorAct',    1, 0, '' );
 insert into Item values ( 5, 'Image Sensor', 1, 0, '' );
+insert into Item values ( 6, 'Scene',        1, 0, '' );
+insert into Item values ( 7, 'Schedule',     1, 0, '' );
 
 
 
@@ -129,7 +155,7 @@ insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsAct
 insert into ItemField select max(f.idField)+1, i.idItem, 1,               'ImgFileName', 4, 'Icone for sensor', 'URL for icone',              0, 1, '',           'url'      from ItemField f, Item i where i.name='Sensor'                         group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Name',        4, 'Name',             'sensor name (unique)',       1, 1, '',           ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IdProfil',    2, 'User profil',      'profil for access',          0, 1, 'UserProfil', ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
-insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Record',      2, 'Record readings',  'record readings',            0, 1, 'YN',         ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Record',      2, 'Record readings',  'record policy',              0, 1, 'RecordT',    ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsInternal',  2, 'Internal',         'is internal fuction',        0, 1, 'YN',         ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ReadCmd',     4, 'Command',          'read command',               0, 1, '',           ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ReadParam',   4, 'Parameter',        'read parameters',            0, 0, '',           ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
@@ -137,6 +163,14 @@ insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Inter
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IdDataType',  2, 'Data Type',        'data type return by sensor', 0, 1, 'DataType',   ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsVisible',   2, 'Show in GUI',      'Show sensor in GUI',         0, 1, 'YN',         ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsActive',    2, 'Active',           'status',                     0, 1, 'YN',         ''         from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'RecordDelta', 3, 'Record deadband', 'min. change to record (deadband)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'RecordInterval', 4, 'Record interval', 'max. time without record (sampled)', 0, 0, '', 'Duration' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'KeepLastVal', 2, 'Keep last value', 'keep last value when not recording', 0, 0, 'YN', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Schedule', 4, 'Schedule', 'crontab like "m h dom mon dow" (replace interval)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Transform', 4, 'Transform', 'steps applied to read value (i.e. regex:T=(.*) | round:1)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'RetentionDays', 2, 'Retention (days)', 'days to keep recorded values (0 = forever)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Timeout', 4, 'Timeout', 'max read duration (i.e. 10s, default 30s)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'StaleAfter', 2, 'Stale after', 'nb of missed readings before sensor is stale (0 = never)', 0, 0, '', '' from ItemField f, Item i where i.name='Sensor' and f.idItem = i.idItem group by i.idItem;
 
 -- HomeObj definition : ImageSensor
 insert into ItemField select max(f.idField)+1, i.idItem, 1,               'ImgFileName', 4, 'Icone for sensor', 'URL for icone',              0, 1, '',           'url' from ItemField f, Item i where i.name='Image Sensor'                         group by i.idItem;
@@ -158,6 +192,8 @@ insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ActPa
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'DynParamType', 2, 'Runtime param. type', 'run time parameter type', 0, 1, 'DynParamT',  ''    from ItemField f, Item i where i.name='Actor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsVisible',    2, 'Show in GUI',         'Show actor in GUI',       0, 1, 'YN',         ''    from ItemField f, Item i where i.name='Actor' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsActive',     2, 'Active',              'status',                  0, 1, 'YN',         ''    from ItemField f, Item i where i.name='Actor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Timeout',      4, 'Timeout',             'max action duration (i.e. 20s, default 30s)', 0, 0, '', '' from ItemField f, Item i where i.name='Actor' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Confirm',      2, 'Confirmation',        'ask confirmation before action', 0, 0, 'YN', '' from ItemField f, Item i where i.name='Actor' and f.idItem = i.idItem group by i.idItem;
 
 -- HomeObj definition : SensorAct
 insert into ItemField select max(f.idField)+1, i.idItem, 1,               'idMasterObj', 2, 'Master',    'linked sensor',     0, 1, 'SensorList', '' from ItemField f, Item i where i.name='SensorAct'                         group by i.idItem;
@@ -165,6 +201,34 @@ insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'idAct
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Condition',   4, 'Condition', 'trigger condition', 0, 0, '',           '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ActorParam',  4, 'Parameter', 'action parameters', 0, 0, '',           '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
 insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsActive',    2, 'Active',    'status',            0, 1, 'YN',         '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'MinInterval', 4, 'Min interval', 'min. time between triggers', 0, 0, '', 'Duration' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'HoldCount', 2, 'Hold count', 'nb consecutive true readings to trigger', 0, 0, '', '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'HoldDuration', 4, 'Hold duration', 'min. time condition is true to trigger', 0, 0, '', 'Duration' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ResetCondition', 4, 'Reset condition', 'condition to re-arm after trigger', 0, 0, '', '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Event', 2, 'Event', 'trigger on new value, sensor stale or recovered', 0, 0, 'SensorEventT', '' from ItemField f, Item i where i.name='SensorAct' and f.idItem = i.idItem group by i.idItem;
+
+-- HomeObj definition : Scene
+-- Steps : json array of steps, i.e. [{"actor":"Portal"},{"delay":"30s","actor":"SendSMS","param":"0123456789 @param@","condition":"sensor(\"Alarm\") == 1","continueOnError":true}]
+insert into ItemField select max(f.idField)+1, i.idItem, 1,               'ImgFileName',  4, 'Icone for scene',     'URL for icone',           0, 1, '',           'url' from ItemField f, Item i where i.name='Scene'                         group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Name',         4, 'Name',                'scene name (unique)',     1, 1, '',           ''    from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IdProfil',     2, 'User profil',         'profil for access',       0, 1, 'UserProfil', ''    from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Steps',        7, 'Steps',               'actors, delays and conditions (json)', 0, 1, '', '' from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'DynParamType', 2, 'Runtime param. type', 'run time parameter type (@param@ in steps)', 0, 1, 'DynParamT', '' from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsVisible',    2, 'Show in GUI',         'Show scene in GUI',       0, 1, 'YN',         ''    from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsActive',     2, 'Active',              'status',                  0, 1, 'YN',         ''    from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Timeout',      4, 'Timeout',             'max scene duration (i.e. 5m, default 10m)', 0, 0, '', '' from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Confirm',      2, 'Confirmation',        'ask confirmation before scene', 0, 0, 'YN', '' from ItemField f, Item i where i.name='Scene' and f.idItem = i.idItem group by i.idItem;
+
+-- HomeObj definition : Schedule
+-- Schedule : crontab like schedule (m h dom mon dow), or RunAt to run only once
+insert into ItemField select max(f.idField)+1, i.idItem, 1,               'Name',         4, 'Name',                'schedule name (unique)',  1, 1, '',           ''    from ItemField f, Item i where i.name='Schedule'                         group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IdProfil',     2, 'User profil',         'profil for access',       0, 1, 'UserProfil', ''    from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'idActor',      2, 'Actor',               'trigger actor or scene',  0, 1, 'ActorList',  ''    from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'ActorParam',   4, 'Parameter',           'action parameters',       0, 0, '',           ''    from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'Schedule',     4, 'Schedule',            'crontab like (m h dom mon dow)', 0, 0, '', ''       from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'RunAt',        4, 'Run once at',         'YYYY-MM-DD hh:mm (instead of schedule)', 0, 0, '', 'DateTime' from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'SkipNext',     2, 'Skip next run',       'next run is skipped',     0, 0, 'YN',         ''    from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
+insert into ItemField select max(f.idField)+1, i.idItem, max(f.nOrder)+1, 'IsActive',     2, 'Active',              'status',                  0, 1, 'YN',         ''    from ItemField f, Item i where i.name='Schedule' and f.idItem = i.idItem group by i.idItem;
 
 
 
@@ -191,6 +255,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, ''
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '4'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Actor : Portal : gpio write pin 22
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/portail.jpg'  from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
@@ -202,6 +268,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '{"pin":22,"do":"w
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Actor : Garage : gpio write pin 23
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/garage.jpg'   from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
@@ -213,6 +281,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '{"pin":23,"do":"w
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Disabled : -- Actor : Hard reset Gsm module : gpio write pin 18
 -- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/gsmreset.png' from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
@@ -224,6 +294,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : -- GSM actor reference
 -- Disabled : insert into goHome select 'GSM', 'resetActorId', max(v.idObject) from ItemFieldVal v;
 
@@ -237,6 +309,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : -- GSM actor reference
 -- Disabled : insert into goHome select 'GSM', 'onOffActorId', max(v.idObject) from ItemFieldVal v;
 
@@ -250,17 +324,21 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 
--- Disabled : -- Actor : SendSMS using Gsm module
+-- Disabled : -- Actor : SendSMS using Gsm module (HTTP gateway if Gsm module is down)
 -- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/gsmsms.png'   from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, 'SendSMS'             from ItemFieldVal v, ItemField f, Item i where f.name='Name'         and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                   from ItemFieldVal v, ItemField f, Item i where f.name='IdProfil'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsInternal'   and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
--- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, 'SendSMS'             from ItemFieldVal v, ItemField f, Item i where f.name='ActCmd'       and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
--- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '/dev/ttyAMA0'        from ItemFieldVal v, ItemField f, Item i where f.name='ActParam'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, 'GsmSMS'              from ItemFieldVal v, ItemField f, Item i where f.name='ActCmd'       and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '/dev/ttyAMA0 192.168.43.1:1116' from ItemFieldVal v, ItemField f, Item i where f.name='ActParam'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '4'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '2m'                  from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 -- Actor : SendSMS using shell script (calling HTTP gateway)
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/sms-blue.png' from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, 'SendSMS'             from ItemFieldVal v, ItemField f, Item i where f.name='Name'         and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
@@ -271,6 +349,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '192.168.43.1:1116
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '4'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Actor' and f.idItem = i.idItem group by f.nOrder;
 
 
 
@@ -289,6 +369,14 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '5m'
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                 from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Sensor : % cpu usage
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/perf.png'   from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
@@ -302,6 +390,14 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '5m'
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                 from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Sensor : Is Alarm on ? : read gpio pin 27
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/alarm.png'  from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
@@ -315,18 +411,36 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1s'
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                 from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- SensorAct : is Alarm in On (read 0) and alarm was off (@lastVal@ < @prevVal@) => sens SMS "Alarm"
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, mv.idObject      from ItemFieldVal mv, ItemField mf, Item mi, ItemFieldVal v, ItemField f, Item i where f.name='idMasterObj' and i.name='SensorAct' and f.idItem = i.idItem and mv.idfield = mv.idfield and mv.val='Alarm'   and mf.name='Name' and mf.idItem = mi.idItem and mi.name = 'Sensor' group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, av.idObject      from ItemFieldVal av, ItemField af, Item ai, ItemFieldVal v, ItemField f, Item i where f.name='idActor'     and i.name='SensorAct' and f.idItem = i.idItem and av.idfield = av.idfield and av.val='SendSMS' and af.name='Name' and af.idItem = ai.idItem and ai.name = 'Actor'  group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '@lastVal@ < @prevVal@' from ItemFieldVal v, ItemField f, Item i where f.name='Condition'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0123123456789 "Alarm maison (@lastVal@)"' from ItemFieldVal v, ItemField f, Item i where f.name='ActorParam'  and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'              from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='MinInterval'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='HoldCount'      and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='HoldDuration'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='ResetCondition' and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='Event'          and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 -- SensorAct : is Alarm in Off (read 1) and alarm was on (@lastVal@ > @prevVal@) => sens SMS "Alarm end"
 insert into ItemFieldVal select max(v.idObject)+1, f.idField, mv.idObject      from ItemFieldVal mv, ItemField mf, Item mi, ItemFieldVal v, ItemField f, Item i where f.name='idMasterObj' and i.name='SensorAct' and f.idItem = i.idItem and mv.idfield = mv.idfield and mv.val='Alarm'   and mf.name='Name' and mf.idItem = mi.idItem and mi.name = 'Sensor' group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, av.idObject      from ItemFieldVal av, ItemField af, Item ai, ItemFieldVal v, ItemField f, Item i where f.name='idActor'     and i.name='SensorAct' and f.idItem = i.idItem and av.idfield = av.idfield and av.val='SendSMS' and af.name='Name' and af.idItem = ai.idItem and ai.name = 'Actor'  group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '@lastVal@ > @prevVal@' from ItemFieldVal v, ItemField f, Item i where f.name='Condition'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '0123123456789 "Fin alarm (@lastVal@)"' from ItemFieldVal v, ItemField f, Item i where f.name='ActorParam'  and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'              from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='MinInterval'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='HoldCount'      and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='HoldDuration'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='ResetCondition' and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='Event'          and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 
 
 
@@ -353,6 +467,14 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '60m'
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '4'                 from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 
 
 -- Disabled : -- Sensor : Is Gsm module on ? : send AT\r to module 
@@ -367,12 +489,25 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                  from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                  from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                  from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : -- SensorAct : Gsm module not responding "OK\r" => restart module
 -- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, mv.idObject      from ItemFieldVal mv, ItemField mf, Item mi, ItemFieldVal v, ItemField f, Item i where f.name='idMasterObj' and i.name='SensorAct' and f.idItem = i.idItem and mv.idfield = mv.idfield and mv.val='GsmIsUp'    and mf.name='Name' and mf.idItem = mi.idItem and mi.name = 'Sensor' group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, av.idObject      from ItemFieldVal av, ItemField af, Item ai, ItemFieldVal v, ItemField f, Item i where f.name='idActor'     and i.name='SensorAct' and f.idItem = i.idItem and av.idfield = av.idfield and av.val='GsmRestart' and af.name='Name' and af.idItem = ai.idItem and ai.name = 'Actor'  group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '@lastVal@ != 1' from ItemFieldVal v, ItemField f, Item i where f.name='Condition'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='ActorParam'  and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'              from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='MinInterval'    and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='HoldCount'      and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='HoldDuration'   and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''               from ItemFieldVal v, ItemField f, Item i where f.name='ResetCondition' and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'              from ItemFieldVal v, ItemField f, Item i where f.name='Event'          and i.name='SensorAct' and f.idItem = i.idItem group by f.nOrder;
 
 
 -- Sensor : Take snapshot from USB webcam using motion 
@@ -387,6 +522,14 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '4'                  from ItemFieldVal v, ItemField f, Item i where f.name='IdDataType'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                  from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordDelta'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='RecordInterval' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='KeepLastVal'  and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Transform'    and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='RetentionDays' and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                   from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                  from ItemFieldVal v, ItemField f, Item i where f.name='StaleAfter'   and i.name='Sensor' and f.idItem = i.idItem group by f.nOrder;
 
 -- Image Sensor : Add USB webcam
 -- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/video.png'  from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName' and i.name='Image Sensor' and f.idItem = i.idItem group by f.nOrder;
@@ -408,6 +551,27 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'   and i.name='Image Sensor' and f.idItem = i.idItem group by f.nOrder;
 -- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                 from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'    and i.name='Image Sensor' and f.idItem = i.idItem group by f.nOrder;
 
+-- Scene : Leaving home : close portal and garage, then send a SMS
+-- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'images/portail.jpg'  from ItemFieldVal v, ItemField f, Item i where f.name='ImgFileName'  and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, 'LeavingHome'         from ItemFieldVal v, ItemField f, Item i where f.name='Name'         and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '2'                   from ItemFieldVal v, ItemField f, Item i where f.name='IdProfil'     and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '[{"actor":"Portal"},{"delay":"30s","actor":"Garage"},{"actor":"SendSMS","param":"0123123456789 Leaving home","continueOnError":true}]' from ItemFieldVal v, ItemField f, Item i where f.name='Steps'        and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='DynParamType' and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsVisible'    and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='Timeout'      and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='Confirm'      and i.name='Scene' and f.idItem = i.idItem group by f.nOrder;
+
+-- Schedule : SMS every sunday at noon to check server is alive
+-- Disabled : insert into ItemFieldVal select max(v.idObject)+1, f.idField, 'SundaySMS'           from ItemFieldVal v, ItemField f, Item i where f.name='Name'         and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IdProfil'     and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, av.idObject           from ItemFieldVal av, ItemField af, Item ai, ItemFieldVal v, ItemField f, Item i where f.name='idActor' and i.name='Schedule' and f.idItem = i.idItem and av.idField = af.idField and av.val='SendSMS' and af.name='Name' and af.idItem = ai.idItem and ai.name = 'Actor' group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0123123456789 goHome is alive' from ItemFieldVal v, ItemField f, Item i where f.name='ActorParam'   and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0 12 * * sun'        from ItemFieldVal v, ItemField f, Item i where f.name='Schedule'     and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, ''                    from ItemFieldVal v, ItemField f, Item i where f.name='RunAt'        and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '0'                   from ItemFieldVal v, ItemField f, Item i where f.name='SkipNext'     and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+-- Disabled : insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'                   from ItemFieldVal v, ItemField f, Item i where f.name='IsActive'     and i.name='Schedule' and f.idItem = i.idItem group by f.nOrder;
+
 
 --List param
 --P1 tel
@@ -418,8 +582,8 @@ insert into ItemFieldVal select max(v.idObject)  , f.idField, '1'
 --idActor - idParam - iOrder
 --
 --
---insert into Item values ( 6, 'Parameter', 1, 0, '' );
---insert into Item values ( 7, 'ParamLink', 1, 0, '' );
+--insert into Item values ( 8, 'Parameter', 1, 0, '' );
+--insert into Item values ( 9, 'ParamLink', 1, 0, '' );
 --
 --
 ---- HomeObj definition : Parameter
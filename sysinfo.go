@@ -0,0 +1,346 @@
+// sysinfo.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// -----------------------------------------------
+// System health internal sensor functions
+//
+// All files are read under -sysroot (default "/") so functions can be tested against fake /proc and /sys trees
+//
+// CpuUsage                    : % cpu used
+// MemoryUsage                 : % memory used
+// DiskUsage     mount         : % disk used for mount point (default "/")
+// SocTemp       zone          : SoC temperature in °C (default thermal_zone0)
+// LoadAverage   1|5|15        : load average (default 1)
+// Uptime                      : seconds since boot
+// NetCounter    iface counter : network interface counter, i.e. "eth0 rx_bytes", "wlan0 tx_errors"
+// ProcessAlive  name|pidfile  : 1 if a process with this name (or pid read from pidfile) is running, else 0
+// FileAge       path          : seconds since file last modification
+// -----------------------------------------------
+
+// cpuDriver : CpuUsage driver, keep previous mesure of the sensor
+type cpuDriver struct {
+	lock    sync.Mutex
+	readNs  int64
+	readVal int
+}
+
+func init() {
+	RegisterDriver(SensorFunc, "CpuUsage", DriverInfo{
+		New: func(obj HomeObject, params interface{}) (Driver, error) { return &cpuDriver{}, nil },
+	})
+	RegisterInternalFunc(SensorFunc, "MemoryUsage", MemoryUsage)
+	RegisterInternalFunc(SensorFunc, "DiskUsage", DiskUsage)
+	RegisterInternalFunc(SensorFunc, "SocTemp", SocTemp)
+	RegisterInternalFunc(SensorFunc, "LoadAverage", LoadAverage)
+	RegisterInternalFunc(SensorFunc, "Uptime", Uptime)
+	RegisterInternalFunc(SensorFunc, "NetCounter", NetCounter)
+	RegisterInternalFunc(SensorFunc, "ProcessAlive", ProcessAlive)
+	RegisterInternalFunc(SensorFunc, "FileAge", FileAge)
+}
+
+// sysPath : path of a system file under sysRoot
+func sysPath(elem ...string) string {
+	return filepath.Join(append([]string{*sysRoot}, elem...)...)
+}
+
+// readSysFile : read first line of a system file
+func readSysFile(elem ...string) (line string, err error) {
+	content, err := ioutil.ReadFile(sysPath(elem...))
+	if err != nil {
+		glog.Errorf("readSysFile : %s", err)
+		return
+	}
+	line = strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0])
+	return
+}
+
+// -----------------------------------------------
+
+func readProcStat() (nano int64, read int, nb int, err error) {
+	nano = time.Now().UnixNano()
+	f, err := os.Open(sysPath("proc", "stat"))
+	if err != nil {
+		glog.Errorf("CpuUsage : %s", err)
+		return
+	}
+	defer f.Close()
+
+	var key string
+	var u, n, s int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, err = fmt.Sscanf(line, "%s %d %d %d", &key, &u, &n, &s)
+		if err != nil {
+			glog.Errorf("Scan fail '%s' : %s", line, err)
+			return
+		}
+		if key == "cpu" {
+			read = u + n + s
+		} else if strings.HasPrefix(key, "cpu") {
+			nb++
+		} else {
+			break
+		}
+	}
+	return
+}
+
+func (d *cpuDriver) Call(ctx context.Context, obj HomeObject, param string) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	nano, read, nb, err := readProcStat()
+	if err != nil {
+		return "99", err
+	}
+
+	// If previous mesure was more than 60s ago (or too recent to be accurate)
+	if elapsed := time.Duration(nano - d.readNs); elapsed > 60*time.Second || elapsed < time.Second {
+		d.readNs = nano
+		d.readVal = read
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+		}
+		nano, read, nb, err = readProcStat()
+		if err != nil {
+			return "99", err
+		}
+	}
+
+	load := float32(int64(read-d.readVal)*1000000000.0) / float32((nano-d.readNs)*int64(nb)*1.0)
+	load += 0.5 // for rounding when converting with %.0f
+
+	if glog.V(1) {
+		glog.Infof("CpuUsage %3.2f = %d / ( %d * %d )", load, (read-d.readVal)*1000000000, nano-d.readNs, nb)
+	}
+
+	d.readNs = nano
+	d.readVal = read
+
+	return fmt.Sprintf("%.0f", load), nil
+}
+
+func (d *cpuDriver) Close() error {
+	return nil
+}
+
+func MemoryUsage(param1 string, param2 string) (string, error) {
+	f, err := os.Open(sysPath("proc", "meminfo"))
+	if err != nil {
+		glog.Errorf("MemoryUsage : %s", err)
+		return "99", err
+	}
+	defer f.Close()
+
+	var key string
+	var val, total, free int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, err = fmt.Sscanf(line, "%s %d", &key, &val)
+		if err != nil {
+			glog.Errorf("Scan fail '%s' : %s", line, err)
+			return "99", err
+		}
+		if key == "MemTotal:" {
+			total = val
+		} else if key == "MemFree:" {
+			free = val
+		} else {
+			break
+		}
+	}
+
+	used := float32((total-free)*100) / float32(total)
+
+	if glog.V(1) {
+		glog.Infof("MemoryUsage %3.2f = %d / %d", used, total, free)
+	}
+
+	return fmt.Sprintf("%.0f", used), nil
+}
+
+// -----------------------------------------------
+
+func DiskUsage(param1 string, param2 string) (string, error) {
+	mount := strings.TrimSpace(param1)
+	if len(mount) <= 0 {
+		mount = "/"
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(sysPath(mount), &stat); err != nil {
+		glog.Errorf("DiskUsage %s : %s", mount, err)
+		return "", err
+	}
+	if stat.Blocks <= 0 {
+		return "0", nil
+	}
+
+	// same as df : used / (used + available to non root users)
+	used := stat.Blocks - stat.Bfree
+	usedPct := float64(used*100) / float64(used+stat.Bavail)
+
+	if glog.V(2) {
+		glog.Infof("DiskUsage %s %3.2f", mount, usedPct)
+	}
+
+	return fmt.Sprintf("%.0f", usedPct), nil
+}
+
+func SocTemp(param1 string, param2 string) (string, error) {
+	zone := strings.TrimSpace(param1)
+	if len(zone) <= 0 {
+		zone = "thermal_zone0"
+	}
+
+	line, err := readSysFile("sys", "class", "thermal", zone, "temp")
+	if err != nil {
+		return "", err
+	}
+	milli, err := strconv.Atoi(line)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("SocTemp %s : bad value '%s'", zone, line))
+	}
+
+	return fmt.Sprintf("%.1f", float64(milli)/1000), nil
+}
+
+func LoadAverage(param1 string, param2 string) (string, error) {
+	line, err := readSysFile("proc", "loadavg")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return "", errors.New(fmt.Sprintf("LoadAverage : bad loadavg '%s'", line))
+	}
+
+	switch strings.TrimSpace(param1) {
+	case "", "1":
+		return fields[0], nil
+	case "5":
+		return fields[1], nil
+	case "15":
+		return fields[2], nil
+	}
+	return "", errors.New(fmt.Sprintf("LoadAverage : bad period '%s' (1, 5 or 15)", param1))
+}
+
+func Uptime(param1 string, param2 string) (string, error) {
+	line, err := readSysFile("proc", "uptime")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 1 {
+		return "", errors.New(fmt.Sprintf("Uptime : bad uptime '%s'", line))
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(int64(uptime), 10), nil
+}
+
+func NetCounter(param1 string, param2 string) (string, error) {
+	params := strings.Fields(param1)
+	if len(params) != 2 {
+		return "", errors.New(fmt.Sprintf("NetCounter : bad parameter '%s' (expect 'iface counter')", param1))
+	}
+	if strings.ContainsAny(params[0]+params[1], "/.") {
+		return "", errors.New(fmt.Sprintf("NetCounter : bad parameter '%s'", param1))
+	}
+	return readSysFile("sys", "class", "net", params[0], "statistics", params[1])
+}
+
+func ProcessAlive(param1 string, param2 string) (string, error) {
+	param := strings.TrimSpace(param1)
+	if len(param) <= 0 {
+		return "", errors.New("ProcessAlive : process name or pidfile expected")
+	}
+
+	// pidfile
+	if strings.HasPrefix(param, "/") {
+		line, err := readSysFile(param)
+		if err != nil {
+			return "0", nil
+		}
+		if _, err = strconv.Atoi(line); err != nil {
+			return "", errors.New(fmt.Sprintf("ProcessAlive : bad pid '%s' in %s", line, param))
+		}
+		if _, err = os.Stat(sysPath("proc", line)); err != nil {
+			return "0", nil
+		}
+		return "1", nil
+	}
+
+	// process name
+	pids, err := ioutil.ReadDir(sysPath("proc"))
+	if err != nil {
+		glog.Errorf("ProcessAlive : %s", err)
+		return "", err
+	}
+	for _, pid := range pids {
+		if _, err := strconv.Atoi(pid.Name()); err != nil {
+			continue
+		}
+		if processNameMatch(pid.Name(), param) {
+			return "1", nil
+		}
+	}
+	return "0", nil
+}
+
+// processNameMatch : check process name using argv[0] base name from cmdline, else using comm
+// comm is truncated by the kernel to 15 characters, cmdline is empty for kernel threads
+func processNameMatch(pid string, name string) bool {
+	cmdline, err := ioutil.ReadFile(sysPath("proc", pid, "cmdline"))
+	if err == nil {
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if len(argv0) > 0 && filepath.Base(argv0) == name {
+			return true
+		}
+	}
+	comm, err := ioutil.ReadFile(sysPath("proc", pid, "comm"))
+	if err != nil {
+		return false
+	}
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return strings.TrimSpace(string(comm)) == name
+}
+
+func FileAge(param1 string, param2 string) (string, error) {
+	path := strings.TrimSpace(param1)
+	if len(path) <= 0 {
+		return "", errors.New("FileAge : file path expected")
+	}
+	info, err := os.Stat(sysPath(path))
+	if err != nil {
+		glog.Errorf("FileAge : %s", err)
+		return "", err
+	}
+	return strconv.FormatInt(int64(time.Since(info.ModTime())/time.Second), 10), nil
+}
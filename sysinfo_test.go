@@ -0,0 +1,154 @@
+// sysinfo_test.go
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// sysTestRoot : fake /proc and /sys tree used as sysRoot until the returned cleanup is called
+func sysTestRoot(t *testing.T, files map[string]string) (root string, cleanup func()) {
+	root, err := ioutil.TempDir("", "sysinfo_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevRoot := *sysRoot
+	*sysRoot = root
+	return root, func() {
+		*sysRoot = prevRoot
+		os.RemoveAll(root)
+	}
+}
+
+func TestSysInfo(t *testing.T) {
+	_, cleanup := sysTestRoot(t, map[string]string{
+		"proc/loadavg":                             "0.52 0.38 0.21 1/123 4567\n",
+		"proc/uptime":                              "12345.67 40000.12\n",
+		"sys/class/thermal/thermal_zone0/temp":     "48312\n",
+		"sys/class/thermal/thermal_zone1/temp":     "bad\n",
+		"sys/class/net/eth0/statistics/rx_bytes":   "987654321\n",
+		"sys/class/net/wlan0/statistics/tx_errors": "3\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		fct    func(string, string) (string, error)
+		name   string
+		param  string
+		want   string
+		hasErr bool
+	}{
+		{SocTemp, "SocTemp", "", "48.3", false},
+		{SocTemp, "SocTemp", "thermal_zone1", "", true},
+		{SocTemp, "SocTemp", "thermal_zone9", "", true},
+		{LoadAverage, "LoadAverage", "", "0.52", false},
+		{LoadAverage, "LoadAverage", "5", "0.38", false},
+		{LoadAverage, "LoadAverage", "15", "0.21", false},
+		{LoadAverage, "LoadAverage", "10", "", true},
+		{Uptime, "Uptime", "", "12345", false},
+		{NetCounter, "NetCounter", "eth0 rx_bytes", "987654321", false},
+		{NetCounter, "NetCounter", "wlan0 tx_errors", "3", false},
+		{NetCounter, "NetCounter", "eth0", "", true},
+		{NetCounter, "NetCounter", "eth0 ../rx_bytes", "", true},
+		{NetCounter, "NetCounter", "eth1 rx_bytes", "", true},
+	}
+	for _, tt := range tests {
+		got, err := tt.fct(tt.param, "")
+		if (err != nil) != tt.hasErr {
+			t.Errorf("%s(%s) : error %v", tt.name, tt.param, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s(%s) = '%s', want '%s'", tt.name, tt.param, got, tt.want)
+		}
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	_, cleanup := sysTestRoot(t, map[string]string{
+		// comm is truncated to 15 characters, argv[0] is a full path
+		"proc/123/comm":    "averylongproces\n",
+		"proc/123/cmdline": "/usr/bin/averylongprocessname\x00-x\x00",
+		// kernel thread : empty cmdline
+		"proc/2/comm":    "kworker_long_na\n",
+		"proc/2/cmdline": "",
+		// argv[0] rewritten by the process
+		"proc/456/comm":    "sshd\n",
+		"proc/456/cmdline": "sshd: /usr/sbin/sshd -D\x00",
+		// not a process
+		"proc/sys/comm": "other\n",
+		"run/sshd.pid":  "456\n",
+		"run/stale.pid": "789\n",
+		"run/bad.pid":   "abc\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		param  string
+		want   string
+		hasErr bool
+	}{
+		{"averylongprocessname", "1", false},
+		{"averylongproces", "1", false},
+		{"averylongproc", "0", false},
+		{"kworker_long_name", "1", false},
+		{"sshd", "1", false},
+		{"other", "0", false},
+		{"/run/sshd.pid", "1", false},
+		{"/run/stale.pid", "0", false},
+		{"/run/missing.pid", "0", false},
+		{"/run/bad.pid", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ProcessAlive(tt.param, "")
+		if (err != nil) != tt.hasErr {
+			t.Errorf("ProcessAlive(%s) : error %v", tt.param, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ProcessAlive(%s) = '%s', want '%s'", tt.param, got, tt.want)
+		}
+	}
+}
+
+func TestFileAgeDiskUsage(t *testing.T) {
+	root, cleanup := sysTestRoot(t, map[string]string{"var/log/app.log": "line\n"})
+	defer cleanup()
+
+	modTime := time.Now().Add(-90 * time.Second)
+	if err := os.Chtimes(filepath.Join(root, "var/log/app.log"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FileAge("/var/log/app.log", "")
+	if age, _ := strconv.Atoi(got); err != nil || age < 90 || age > 91 {
+		t.Errorf("FileAge = '%s' (%v), want 90", got, err)
+	}
+	if _, err = FileAge("/var/log/missing.log", ""); err == nil {
+		t.Error("FileAge of a missing file : no error")
+	}
+	if _, err = FileAge("", ""); err == nil {
+		t.Error("FileAge without path : no error")
+	}
+
+	got, err = DiskUsage("/var", "")
+	if pct, _ := strconv.Atoi(got); err != nil || pct < 0 || pct > 100 {
+		t.Errorf("DiskUsage = '%s' (%v), want a percentage", got, err)
+	}
+	if _, err = DiskUsage("/missing", ""); err == nil {
+		t.Error("DiskUsage of a missing mount : no error")
+	}
+}
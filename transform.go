@@ -0,0 +1,258 @@
+// transform.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------
+
+// Sensor 'Transform' : chain of steps applied to raw sensor reading, separated by '|' (use '||' for a literal '|')
+//
+// regex:<pattern>         first capture group (or whole match) of pattern
+// json:<path>             value at path in a json document, i.e. json:data.sensors[0].temp
+// scale:<factor>[,<offset>] value * factor + offset
+// round:<decimals>        round to decimals
+// unit:<from>-><to>       unit conversion, see transformUnits (i.e. unit:F->C)
+// map:<in>=<out>,...      lookup map, '*' for default output (i.e. map:ON=1,OFF=0,*=-1)
+//
+// Example : json:main.temp | unit:K->C | round:1
+
+type transformStep struct {
+	name string
+	arg  string
+	fct  func(value string) (string, error)
+}
+
+// transformUnits : linear unit conversions (value * factor + offset)
+var transformUnits = map[string][2]float64{
+	"C->F":      {9.0 / 5.0, 32},
+	"F->C":      {5.0 / 9.0, -160.0 / 9.0},
+	"K->C":      {1, -273.15},
+	"C->K":      {1, 273.15},
+	"W->kW":     {0.001, 0},
+	"kW->W":     {1000, 0},
+	"Wh->kWh":   {0.001, 0},
+	"kWh->Wh":   {1000, 0},
+	"mV->V":     {0.001, 0},
+	"V->mV":     {1000, 0},
+	"Pa->hPa":   {0.01, 0},
+	"hPa->Pa":   {100, 0},
+	"m/s->km/h": {3.6, 0},
+	"km/h->m/s": {1 / 3.6, 0},
+	"s->min":    {1.0 / 60.0, 0},
+	"min->s":    {60, 0},
+}
+
+// -----------------------------------------------
+
+// compileTransform : parse a transform chain
+func compileTransform(spec string) (steps []transformStep, err error) {
+	spec = strings.Replace(spec, "||", "\x00", -1)
+	for _, stepSpec := range strings.Split(spec, "|") {
+		stepSpec = strings.TrimSpace(strings.Replace(stepSpec, "\x00", "|", -1))
+		if len(stepSpec) <= 0 {
+			continue
+		}
+		i := strings.Index(stepSpec, ":")
+		if i < 0 {
+			return nil, errors.New(fmt.Sprintf("bad transform step '%s' : expect name:arg", stepSpec))
+		}
+		step := transformStep{name: strings.TrimSpace(stepSpec[:i]), arg: strings.TrimSpace(stepSpec[i+1:])}
+		if step.fct, err = newTransformFct(step.name, step.arg); err != nil {
+			return nil, errors.New(fmt.Sprintf("bad transform step '%s' : %s", stepSpec, err))
+		}
+		steps = append(steps, step)
+	}
+	return
+}
+
+// applyTransform : apply transform steps to value
+func applyTransform(steps []transformStep, value string) (result string, err error) {
+	result = value
+	for _, step := range steps {
+		if result, err = step.fct(result); err != nil {
+			return "", errors.New(fmt.Sprintf("transform %s:%s failed for '%s' : %s", step.name, step.arg, cleanSpaces(value), err))
+		}
+	}
+	return
+}
+
+// -----------------------------------------------
+
+func newTransformFct(name string, arg string) (fct func(value string) (string, error), err error) {
+	switch name {
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		fct = func(value string) (string, error) {
+			match := re.FindStringSubmatch(value)
+			if match == nil {
+				return "", errors.New("no match")
+			}
+			if len(match) > 1 {
+				return match[1], nil
+			}
+			return match[0], nil
+		}
+
+	case "json":
+		path, err := parseJsonPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		fct = func(value string) (string, error) {
+			return jsonPathValue(value, path)
+		}
+
+	case "scale":
+		args := strings.Split(arg, ",")
+		if len(args) > 2 {
+			return nil, errors.New("expect factor[,offset]")
+		}
+		factor, err := strconv.ParseFloat(strings.TrimSpace(args[0]), 64)
+		if err != nil {
+			return nil, err
+		}
+		offset := 0.0
+		if len(args) > 1 {
+			if offset, err = strconv.ParseFloat(strings.TrimSpace(args[1]), 64); err != nil {
+				return nil, err
+			}
+		}
+		fct = linearTransform(factor, offset)
+
+	case "round":
+		decimals, err := strconv.Atoi(arg)
+		if err != nil || decimals < 0 {
+			return nil, errors.New("expect number of decimals")
+		}
+		fct = func(value string) (string, error) {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return "", err
+			}
+			p := math.Pow(10, float64(decimals))
+			return strconv.FormatFloat(math.Round(v*p)/p, 'f', decimals, 64), nil
+		}
+
+	case "unit":
+		conv, found := transformUnits[strings.Replace(arg, " ", "", -1)]
+		if !found {
+			return nil, errors.New(fmt.Sprintf("unknown unit conversion '%s'", arg))
+		}
+		fct = linearTransform(conv[0], conv[1])
+
+	case "map":
+		lookup := map[string]string{}
+		for _, pair := range strings.Split(arg, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.New(fmt.Sprintf("bad map entry '%s' : expect in=out", pair))
+			}
+			lookup[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		fct = func(value string) (string, error) {
+			if out, found := lookup[strings.TrimSpace(value)]; found {
+				return out, nil
+			}
+			if out, found := lookup["*"]; found {
+				return out, nil
+			}
+			return "", errors.New("no map entry")
+		}
+
+	default:
+		err = errors.New(fmt.Sprintf("unknown transform '%s'", name))
+	}
+	return
+}
+
+func linearTransform(factor float64, offset float64) func(value string) (string, error) {
+	return func(value string) (string, error) {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(v*factor+offset, 'f', -1, 64), nil
+	}
+}
+
+// -----------------------------------------------
+
+// parseJsonPath : split "a.b[2].c" into keys (string) and indexes (int)
+func parseJsonPath(path string) (keys []interface{}, err error) {
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		if i := strings.Index(part, "["); i >= 0 {
+			name = part[:i]
+		}
+		if len(name) > 0 {
+			keys = append(keys, name)
+		}
+		for rest := part[len(name):]; len(rest) > 0; {
+			end := strings.Index(rest, "]")
+			if rest[0] != '[' || end < 0 {
+				return nil, errors.New(fmt.Sprintf("bad json path '%s'", path))
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("bad index in json path '%s'", path))
+			}
+			keys = append(keys, index)
+			rest = rest[end+1:]
+		}
+	}
+	if len(keys) <= 0 {
+		err = errors.New("empty json path")
+	}
+	return
+}
+
+// jsonPathValue : return value at path in json document
+func jsonPathValue(doc string, path []interface{}) (string, error) {
+	val, err := jsonPathRaw(doc, path)
+	if err != nil {
+		return "", err
+	}
+	return exprFormat(val), nil
+}
+
+// jsonPathRaw : return value at path in json document as a string, float64 or bool
+func jsonPathRaw(doc string, path []interface{}) (interface{}, error) {
+	var cur interface{}
+	if err := json.Unmarshal([]byte(doc), &cur); err != nil {
+		return nil, err
+	}
+	for _, key := range path {
+		switch k := key.(type) {
+		case string:
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("'%s' : not an object", k))
+			}
+			if cur, ok = obj[k]; !ok {
+				return nil, errors.New(fmt.Sprintf("'%s' not found", k))
+			}
+		case int:
+			arr, ok := cur.([]interface{})
+			if !ok || k < 0 || k >= len(arr) {
+				return nil, errors.New(fmt.Sprintf("[%d] : not found", k))
+			}
+			cur = arr[k]
+		}
+	}
+	switch cur.(type) {
+	case string, float64, bool:
+		return cur, nil
+	}
+	return nil, errors.New("not a single value")
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"errors"
@@ -12,7 +13,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -173,89 +173,17 @@ func doBackup() {
 // -----------------------------------------------
 
 // nextMatchingdatetime Calc next date & time after now matching datetimeParam
-// datetimeParam : "(*|[0-9]+) (*|[0-9]+) (*|[0-9]+) ..." (simple crontab form, only "m h dom" are used)
+// datetimeParam : crontab like schedule "m h dom mon dow", see parseCronSchedule
 func nextMatchingDatetime(datetimeParam string, now time.Time) (nextAt time.Time, err error) {
-
-	datetimeParam = cleanSpaces(datetimeParam)
-	timecrit := strings.Split(datetimeParam, " ") // m h dom ...
-
-	m := now.Minute()
-	if timecrit[0] != "*" {
-		m, err = strconv.Atoi(timecrit[0])
-		if err != nil {
-			glog.Errorf("nextMatchingDatetime : bad date/time 'm' : %s : %s", datetimeParam, err)
-			return
-		}
-	}
-	h := now.Hour()
-	if timecrit[1] != "*" {
-		h, err = strconv.Atoi(timecrit[1])
-		if err != nil {
-			glog.Errorf("nextMatchingDatetime : bad date/time 'h' : %s : %s", datetimeParam, err)
-			return
-		}
-	}
-	d := now.Day()
-	if timecrit[2] != "*" {
-		d, err = strconv.Atoi(timecrit[2])
-		if err != nil {
-			glog.Errorf("nextMatchingDatetime : bad date/time 'dom' : %s : %s", datetimeParam, err)
-			return
-		}
+	sched, err := parseCronSchedule(datetimeParam)
+	if err != nil {
+		glog.Errorf("nextMatchingDatetime : %s", err)
+		return
 	}
 
-	nextAt = time.Date(now.Year(), now.Month(), d, h, m, 0, 0, now.Location())
-
-	maxDayOfMonth := 31
-	for nextAt.Before(now) {
-		if timecrit[0] == "*" && nextAt.Minute() < 59 {
-			nextAt = nextAt.Add(time.Minute)
-		} else if timecrit[1] == "*" && nextAt.Hour() < 23 {
-			if timecrit[0] == "*" {
-				nextAt = nextAt.Add(time.Minute)
-			} else {
-				nextAt = nextAt.Add(time.Hour)
-			}
-		} else if timecrit[2] == "*" && nextAt.Day() < maxDayOfMonth {
-			curMonth := nextAt.Month()
-			plus := nextAt
-			if timecrit[0] == "*" && timecrit[1] == "*" {
-				plus = plus.Add(time.Minute)
-			} else if timecrit[0] == "*" && timecrit[1] != "*" {
-				plus = time.Date(plus.Year(), plus.Month(), plus.Day(), plus.Hour(), 0, 0, 0, now.Location())
-				plus = plus.Add(24 * time.Hour)
-			} else if timecrit[1] == "*" {
-				plus = nextAt.Add(time.Hour)
-			} else {
-				plus = plus.Add(24 * time.Hour)
-			}
-			if curMonth == plus.Month() {
-				nextAt = plus
-			} else {
-				maxDayOfMonth = nextAt.Day()
-			}
-		} else {
-			y := nextAt.Year()
-			mo := int(nextAt.Month()) + 1
-			if mo > 12 {
-				mo = 1
-				y += 1
-			}
-			m = nextAt.Minute()
-			if timecrit[0] == "*" {
-				m = 0
-			}
-			h = nextAt.Hour()
-			if timecrit[1] == "*" {
-				h = 0
-			}
-			d = nextAt.Day()
-			if timecrit[2] == "*" {
-				d = 0
-			}
-
-			nextAt = time.Date(y, time.Month(mo), d, h, m, 0, 0, now.Location())
-		}
+	if nextAt, err = sched.Next(now); err != nil {
+		glog.Errorf("nextMatchingDatetime : %s", err)
+		return
 	}
 
 	if glog.V(2) {
@@ -284,11 +212,19 @@ func cleanSpaces(in string) (out string) {
 
 // execCommand : execute cmd string and return output (stdout+stderr)
 func execCommand(cmd string) (result string, err error) {
+	return execCommandContext(context.Background(), cmd)
+}
+
+// execCommandContext : execute cmd string and return output (stdout+stderr), process is killed when ctx is done
+func execCommandContext(ctx context.Context, cmd string) (result string, err error) {
 	cmdTab := strings.Split(cleanSpaces(cmd), " ")
 
-	cmdStruct := exec.Command(cmdTab[0], cmdTab[1:]...)
+	cmdStruct := exec.CommandContext(ctx, cmdTab[0], cmdTab[1:]...)
 
 	resultBytes, err := cmdStruct.CombinedOutput()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		glog.Errorf("execCommand fail : %v : %v", cmdTab, err)
 		glog.Errorf("CombinedOutput = %s", string(resultBytes))
@@ -4,12 +4,16 @@ const cReadItem         =   2;
 const cReadUsers        =  10;
 const cReadCurrentUser  =  11;
 const cReadActors       =  20;
+const cReadScenes       =  21;
 const cReadImgSensor    =  30;
 const cReadSensor       =  40;
 const cReadSensorVal    =  41;
 const cGetSensorLastVal =  42;
 const cReadSensorAct    =  50;
+const cReadSchedules    =  60;
 const cTriggerActor     = 100;
+const cGetActorJob      = 101;
+const cConfirmActor     = 102;
 const cSaveObject       = 200;
 
 const DBTypeNone       = 0;
@@ -19,6 +23,7 @@ const DBTypeFloat      = 3;
 const DBTypeText       = 4;
 const DBTypeDateTime   = 5;
 const DBTypeURL        = 6;
+const DBTypeJSON       = 7;
 
 
 var fc = new Object({
@@ -27,8 +32,10 @@ var fc = new Object({
 	currentUser: null,
 	userList: null,
 	actorList: null,
+	sceneList: null,
 	sensorList: null,
 	sensorActList : null,
+	scheduleList: null,
 	imgSensorList: null,
 	imgSensorSrc: '',
 });
@@ -42,6 +49,8 @@ function getReadForItemId( itemId ) {
 	case 3: return cReadActors;
 	case 4: return cReadSensorAct;
 	case 5: return cReadImgSensor;
+	case 6: return cReadScenes;
+	case 7: return cReadSchedules;
 	default:return 0;
 	}
 }
@@ -53,6 +62,8 @@ function getItemIdForRead( action ) {
 	case cReadActors:    return 3;
 	case cReadSensorAct: return 4;
 	case cReadImgSensor: return 5;
+	case cReadScenes:    return 6;
+	case cReadSchedules: return 7;
 	default :            return 0;
 	}
 }
@@ -64,10 +75,20 @@ function objectListForItemId(itemId) {
 	case 3: return fc.actorList;
 	case 4: return fc.sensorActList;
 	case 5: return fc.imgSensorList;
+	case 6: return fc.sceneList;
+	case 7: return fc.scheduleList;
 	default:return [];
 	}
 }
 
+// actors and scenes, all triggered as actors
+function actionList() {
+	var lst = new Array();
+	if ( fc.actorList != null ) lst = lst.concat(fc.actorList);
+	if ( fc.sceneList != null ) lst = lst.concat(fc.sceneList);
+	return lst;
+}
+
 // ---------------------------
 
 function htmlEncode(str) {
@@ -110,7 +131,7 @@ function refListGetVal( refList, lstname, code ) {
 
 function refListFromNames( listName, objList ) {
 	var refList = new Array();
-	if ( objList == null ) return refList;
+	if ( objList == null || objList.length == 0 ) return refList;
 	var nameIdx = 0;
 	var i = 0;
 	for (i = 0; i < objList[0].Fields.length; i++) {
@@ -221,11 +242,16 @@ function getObjectName(obj) {
 	case 2: // Sensor;
 	case 3: // Actors;
 	case 5: // ImgSensor;
+	case 6: // Scenes;
 		return getObjVal(obj,"Name");
 	case 4: // SensorAct
 		return getObjVal(getObjById(fc.sensorList,getObjVal(obj,"idMasterObj")),"Name") + " to " +
-			   getObjVal(getObjById(fc.actorList,getObjVal(obj,"idActor")),"Name") + " on '" +
+			   getObjVal(getObjById(actionList(),getObjVal(obj,"idActor")),"Name") + " on '" +
 			   htmlEncode(getObjVal(obj,"Condition")) + "'";
+	case 7: // Schedule
+		return getObjVal(obj,"Name") + " : " +
+			   getObjVal(getObjById(actionList(),getObjVal(obj,"idActor")),"Name") + " at '" +
+			   htmlEncode(getObjVal(obj,"Schedule") + getObjVal(obj,"RunAt")) + "'";
 	default:
 		return 'Object_' + obj.Values[0].IdObject ;
 	}
@@ -286,7 +312,16 @@ function callServer(action,cmde){
 				if ( fc.refList == null ) {
 					fc.refList = new Object();
 				}
-				fc.refList['ActorList'] = refListFromNames('ActorList', fc.actorList);
+				fc.refList['ActorList'] = refListFromNames('ActorList', fc.actorList).concat(refListFromNames('ActorList', fc.sceneList));
+				gohActors();
+				gohAdminTab();
+				break;
+			case cReadScenes:
+				fc.sceneList = $.parseJSON(data);
+				if ( fc.refList == null ) {
+					fc.refList = new Object();
+				}
+				fc.refList['ActorList'] = refListFromNames('ActorList', fc.actorList).concat(refListFromNames('ActorList', fc.sceneList));
 				gohActors();
 				gohAdminTab();
 				break;
@@ -320,12 +355,32 @@ function callServer(action,cmde){
 				fc.sensorActList = $.parseJSON(data);
 				gohAdminTab();
 				break;
+			case cReadSchedules:
+				fc.scheduleList = $.parseJSON(data);
+				gohAdminTab();
+				break;
 			case cSaveObject:
 				// Reload Objects from server, this will update GUI as well
 				setTimeout(function() { readObjectLst( getReadForItemId(cmde.itemid) ); }, 100);
 				break;
 			case cTriggerActor:
-				gohMessage( retour.response, 'success', 1500);
+			case cConfirmActor:
+			case cGetActorJob:
+				if ( retour.confirm != null ) {
+					// Sensitive actor : confirm (or reject) before token expiration
+					var jconfirm = $.toJSON({ Token:retour.confirm.Token, Reject:!confirm('Confirm action ?') });
+					callServer(cConfirmActor,{ command:'ConfirmActor', itemid:0, objectid:retour.confirm.IdObject, startts:0, endts:0, jsonparam:jconfirm });
+				} else if ( retour.job != null && retour.job.Status == 'running' ) {
+					// Slow actor : wait for job end
+					if ( action != cGetActorJob ) {
+						gohMessage( retour.response, 'info', 1500);
+					}
+					callServer(cGetActorJob,{ command:'GetActorJob', itemid:0, objectid:0, startts:0, endts:0, jsonparam:$.toJSON({ JobId:retour.job.JobId, Wait:30 }) });
+				} else if ( retour.job != null && retour.job.Status != 'done' ) {
+					gohMessage( retour.response, 'danger', 3000);
+				} else {
+					gohMessage( retour.response, 'success', 1500);
+				}
 				break;
 			default:
 				gohMessage('callServer : action inconnue (' + action + ')', 'danger',3000);
@@ -367,20 +422,21 @@ function gohHeader() {
 // goh-actors
 
 function gohActors() {
-	if ( fc.actorList == null ) return;
+	if ( fc.actorList == null && fc.sceneList == null ) return;
+	var actions = actionList();
 	var html = '';
 	var i = 0;
-	for (i = 0; i < fc.actorList.length; i++) {
-		if ( getObjVal(fc.actorList[i],"IsVisible") == '1' ) {
+	for (i = 0; i < actions.length; i++) {
+		if ( getObjVal(actions[i],"IsVisible") == '1' ) {
 			html = html + '<button type="button" class="btn btn-link" style="background:none; width:130px; color:black;" data-toggle="modal" data-target="#actormodal_' + i + '">';
-			html = html + getObjVal(fc.actorList[i],"Name") + '<br><img class="icone" src="';
-			html = html + getObjVal(fc.actorList[i],"ImgFileName") + '"></img></button>';
+			html = html + getObjVal(actions[i],"Name") + '<br><img class="icone" src="';
+			html = html + getObjVal(actions[i],"ImgFileName") + '"></img></button>';
 
 			html = html + '<div id="actormodal_' + i + '" class="modal fade" role="dialog">';
 			html = html + '<div class="modal-dialog"><div class="modal-content">';
 			html = html + '<div class="modal-header"><h4 class="modal-title">Confirmation</h4></div>';
-			html = html + '<div class="modal-body">Actionner ' + getObjVal(fc.actorList[i],"Name") ;
-			if ( getObjVal(fc.actorList[i],"DynParamType") != '0' ) {
+			html = html + '<div class="modal-body">Actionner ' + getObjVal(actions[i],"Name") ;
+			if ( getObjVal(actions[i],"DynParamType") != '0' ) {
 				html = html + '<input id="actorparam_' + i + '" type="text" class="form-control"></span>';
 			}
 			html = html + '</div><div class="modal-footer" style="text-align:center;" >';
@@ -394,12 +450,13 @@ function gohActors() {
 }
 
 function actionner(idx) {
+	var actions = actionList();
 	var jparam = '' ;
-	if ( getObjVal(fc.actorList[idx],"DynParamType") != '0' ) {
+	if ( getObjVal(actions[idx],"DynParamType") != '0' ) {
 		jparam = $("#actorparam_"+idx).val();
 	}
-//console.log( fc.actorList[idx].Values[0].IdObject + '-' + jparam );
-	callServer(cTriggerActor,{ command:'TriggerActor', itemid:0, objectid:fc.actorList[idx].Values[0].IdObject, startts:0, endts:0, jsonparam:jparam });
+//console.log( actions[idx].Values[0].IdObject + '-' + jparam );
+	callServer(cTriggerActor,{ command:'TriggerActor', itemid:0, objectid:actions[idx].Values[0].IdObject, startts:0, endts:0, jsonparam:jparam });
 }
 
 // ---------------------------
@@ -722,6 +779,9 @@ function initFullIHM() {
 	// Read actors
 	readObjectLst(cReadActors);
 
+	// Read scenes i.e. actor sequences
+	readObjectLst(cReadScenes);
+
 	// Read img sensors
 	readObjectLst(cReadImgSensor);
 
@@ -733,6 +793,9 @@ function initFullIHM() {
 
 	// Read sensorAct i.e. actors trigger by sensor reading
 	readObjectLst(cReadSensorAct);
+
+	// Read schedules i.e. actors trigger at fixed times
+	readObjectLst(cReadSchedules);
 }
 
 // ---------------------------